@@ -0,0 +1,120 @@
+package traefik_inline_response
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ACMEChallenge is the configuration for responding to the ACME HTTP-01
+// challenges with the key authorizations of the tokens.
+type ACMEChallenge struct {
+	Tokens    map[string]string `json:"tokens" mapstructure:"tokens"`
+	Directory *string           `json:"directory" mapstructure:"directory"`
+}
+
+const acmeChallengePathPrefix = "/.well-known/acme-challenge/"
+
+// acmeTokenRegex matches the ACME tokens, which are base64url encoded
+// without padding. This also keeps the tokens from escaping the directory.
+var acmeTokenRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+type acmeRuntime struct {
+	tokens    map[string]string
+	directory string
+}
+
+func validateACMEChallenge(a *ACMEChallenge) (*acmeRuntime, error) {
+	if a == nil {
+		return nil, nil
+	}
+
+	if len(a.Tokens) == 0 && a.Directory == nil {
+		return nil, fmt.Errorf("at least one of tokens or directory must be specified in acme")
+	}
+
+	r := &acmeRuntime{
+		tokens: make(map[string]string),
+	}
+	for token, keyAuth := range a.Tokens {
+		if !acmeTokenRegex.MatchString(token) {
+			return nil, fmt.Errorf("invalid token %q in acme, must only contain base64url characters", token)
+		}
+		if keyAuth == "" {
+			return nil, fmt.Errorf("must specify a key authorization for token %q in acme", token)
+		}
+		r.tokens[token] = keyAuth
+	}
+
+	if a.Directory != nil {
+		info, err := os.Stat(*a.Directory)
+		if err != nil {
+			return nil, fmt.Errorf("invalid directory %q in acme, reason: %w", *a.Directory, err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("invalid directory %q in acme, reason: not a directory", *a.Directory)
+		}
+		r.directory = *a.Directory
+	}
+
+	return r, nil
+}
+
+// matcher returns the matcher serving the challenges.
+func (a *acmeRuntime) matcher() *matcherRuntime {
+	prefix := acmeChallengePathPrefix
+	return &matcherRuntime{
+		path: &pathRuntime{
+			mode:   pathMatcherModePrefix,
+			prefix: &prefix,
+		},
+		methods:    []string{http.MethodGet, http.MethodHead},
+		statusCode: http.StatusOK,
+		resp: &responseRuntime{
+			mode: responseModeACME,
+			acme: a,
+		},
+	}
+}
+
+// keyAuthorization returns the key authorization for the token. The
+// configured tokens take precedence over the token files, which are read
+// on every request so that the files written by the ACME client are picked
+// up without a restart.
+func (a *acmeRuntime) keyAuthorization(token string) (string, bool) {
+	if !acmeTokenRegex.MatchString(token) {
+		return "", false
+	}
+	if keyAuth, ok := a.tokens[token]; ok {
+		return keyAuth, true
+	}
+	if a.directory == "" {
+		return "", false
+	}
+	b, err := os.ReadFile(filepath.Join(a.directory, token))
+	if err != nil {
+		return "", false
+	}
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 {
+		return "", false
+	}
+	return string(b), true
+}
+
+func (a *acmeRuntime) respond(state *requestState, writer http.ResponseWriter) {
+	token := strings.TrimPrefix(state.req.URL.Path, acmeChallengePathPrefix)
+	keyAuth, ok := a.keyAuthorization(token)
+	if !ok {
+		http.NotFound(writer, state.req)
+		return
+	}
+	writer.Header().Set("Content-Type", "application/octet-stream")
+	writer.WriteHeader(http.StatusOK)
+	//nolint:errcheck
+	writer.Write([]byte(keyAuth))
+}
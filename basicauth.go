@@ -0,0 +1,230 @@
+package traefik_inline_response
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// BasicAuth is the configuration for requiring HTTP basic authentication
+// for the requests matching the matcher. The users are specified as
+// user:hash entries in the htpasswd format, inline or in a file.
+type BasicAuth struct {
+	Realm      *string  `json:"realm" mapstructure:"realm"`
+	Users      []string `json:"users" mapstructure:"users"`
+	UsersFile  *string  `json:"usersFile" mapstructure:"usersFile"`
+	StatusCode *int     `json:"statusCode" mapstructure:"statusCode"`
+	Resp       Response `json:"response" mapstructure:"response"`
+}
+
+const (
+	defaultBasicAuthRealm = "Restricted"
+	bcryptHashPrefix      = "$2"
+	sha256HashPrefix      = "{SHA256}"
+	sha1HashPrefix        = "{SHA}"
+)
+
+// maxBcryptCost bounds the cost of the bcrypt hashes, since every increment
+// doubles the time taken for verifying the password on every request.
+const maxBcryptCost = 14
+
+// maxVerifiedCredentials bounds the number of credentials whose bcrypt
+// verification is remembered, since bcrypt is deliberately slow.
+const maxVerifiedCredentials = 1000
+
+type basicAuthRuntime struct {
+	challenge  string
+	users      map[string]*passwordHash
+	dummy      *passwordHash
+	statusCode int
+	resp       *responseRuntime
+
+	mu       sync.Mutex
+	verified map[[sha256.Size]byte]bool
+}
+
+// passwordHash is either a bcrypt hash or a SHA digest of the password.
+type passwordHash struct {
+	bcrypt []byte
+	cost   int
+	digest []byte
+	sha1   bool
+}
+
+func validateBasicAuth(auth *BasicAuth) (*basicAuthRuntime, error) {
+	if auth == nil {
+		return nil, nil
+	}
+
+	realm := defaultBasicAuthRealm
+	if auth.Realm != nil {
+		realm = *auth.Realm
+	}
+	b := &basicAuthRuntime{
+		challenge:  "Basic realm=" + strconv.Quote(realm) + `, charset="UTF-8"`,
+		users:      make(map[string]*passwordHash),
+		statusCode: http.StatusUnauthorized,
+		verified:   make(map[[sha256.Size]byte]bool),
+	}
+
+	entries := auth.Users
+	if auth.UsersFile != nil {
+		lines, err := readHtpasswdFile(*auth.UsersFile)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, lines...)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("must specify at least one user in matcher basic auth")
+	}
+	for _, e := range entries {
+		user, hash, ok := strings.Cut(e, ":")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("invalid user entry in matcher basic auth, must be of the form user:hash")
+		}
+		h, err := parsePasswordHash(hash)
+		if err != nil {
+			return nil, fmt.Errorf("invalid password hash for user %q in matcher basic auth, reason: %w", user, err)
+		}
+		b.users[user] = h
+		if b.dummy == nil || h.cost > b.dummy.cost {
+			b.dummy = h
+		}
+	}
+
+	if auth.StatusCode != nil {
+		b.statusCode = *auth.StatusCode
+	}
+	resp, err := validateResponse(&auth.Resp, "matcher basic auth", false)
+	if err != nil {
+		return nil, err
+	}
+	b.resp = resp
+
+	return b, nil
+}
+
+// readHtpasswdFile returns the user entries in the htpasswd file, skipping
+// the blank lines and the comments.
+func readHtpasswdFile(path string) ([]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the users file in matcher basic auth, reason: %w", err)
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+func parsePasswordHash(hash string) (*passwordHash, error) {
+	switch {
+	case strings.HasPrefix(hash, bcryptHashPrefix):
+		cost, err := bcrypt.Cost([]byte(hash))
+		if err != nil {
+			return nil, fmt.Errorf("malformed bcrypt hash, reason: %w", err)
+		}
+		if cost > maxBcryptCost {
+			return nil, fmt.Errorf("bcrypt cost %d exceeds the maximum of %d", cost, maxBcryptCost)
+		}
+		return &passwordHash{bcrypt: []byte(hash), cost: cost}, nil
+	case strings.HasPrefix(hash, sha256HashPrefix):
+		d, err := base64.StdEncoding.DecodeString(hash[len(sha256HashPrefix):])
+		if err != nil || len(d) != sha256.Size {
+			return nil, fmt.Errorf("malformed SHA256 hash")
+		}
+		return &passwordHash{digest: d}, nil
+	case strings.HasPrefix(hash, sha1HashPrefix):
+		d, err := base64.StdEncoding.DecodeString(hash[len(sha1HashPrefix):])
+		if err != nil || len(d) != sha1.Size {
+			return nil, fmt.Errorf("malformed SHA hash")
+		}
+		return &passwordHash{digest: d, sha1: true}, nil
+	default:
+		return nil, fmt.Errorf("unsupported hash, must be one of bcrypt, {SHA256} or {SHA}")
+	}
+}
+
+// authenticate returns true if the request carries the credentials of one
+// of the users, in which case the user name is recorded in the state.
+func (b *basicAuthRuntime) authenticate(state *requestState) bool {
+	user, password, ok := state.req.BasicAuth()
+	if !ok {
+		return false
+	}
+	h, ok := b.users[user]
+	if !ok {
+		// Verify against the slowest hash anyway, so that the unknown users
+		// cannot be told apart from the known ones by the response time.
+		b.dummy.matches(password)
+		return false
+	}
+	if !b.verify(h, user, password) {
+		return false
+	}
+	state.username = user
+	return true
+}
+
+// verify returns true if the password of the user matches the hash,
+// remembering the successfully verified bcrypt credentials.
+func (b *basicAuthRuntime) verify(h *passwordHash, user string, password string) bool {
+	if h.bcrypt == nil {
+		return h.matches(password)
+	}
+
+	key := sha256.Sum256([]byte(user + "\x00" + password))
+	b.mu.Lock()
+	ok := b.verified[key]
+	b.mu.Unlock()
+	if ok {
+		return true
+	}
+	if !h.matches(password) {
+		return false
+	}
+
+	b.mu.Lock()
+	if len(b.verified) >= maxVerifiedCredentials {
+		b.verified = make(map[[sha256.Size]byte]bool)
+	}
+	b.verified[key] = true
+	b.mu.Unlock()
+	return true
+}
+
+// matches returns true if the password matches the hash.
+func (h *passwordHash) matches(password string) bool {
+	if h.bcrypt != nil {
+		return bcrypt.CompareHashAndPassword(h.bcrypt, []byte(password)) == nil
+	}
+
+	var d []byte
+	if h.sha1 {
+		s := sha1.Sum([]byte(password))
+		d = s[:]
+	} else {
+		s := sha256.Sum256([]byte(password))
+		d = s[:]
+	}
+	return subtle.ConstantTimeCompare(d, h.digest) == 1
+}
@@ -0,0 +1,135 @@
+package traefik_inline_response
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/url"
+	"regexp"
+)
+
+// BodyMatcher is a set of conditions on the request body, all of which
+// must be satisfied for the matcher to match the request.
+type BodyMatcher struct {
+	Regex *string         `json:"regex" mapstructure:"regex"`
+	JSON  []JSONPredicate `json:"json" mapstructure:"json"`
+	Form  []FormPredicate `json:"form" mapstructure:"form"`
+}
+
+// FormPredicate is a condition on a field of a URL encoded form body.
+type FormPredicate struct {
+	Name   string  `json:"name" mapstructure:"name"`
+	Equals *string `json:"equals" mapstructure:"equals"`
+	Regex  *string `json:"regex" mapstructure:"regex"`
+}
+
+const defaultMaxBodySize = 1 << 20
+
+type bodyMatcherRuntime struct {
+	regex *regexp.Regexp
+	json  []*jsonPredicateRuntime
+	form  []*formPredicateRuntime
+}
+
+type formPredicateRuntime struct {
+	name   string
+	equals *string
+	regex  *regexp.Regexp
+}
+
+func validateBodyMatcher(body *BodyMatcher) (*bodyMatcherRuntime, error) {
+	if body == nil {
+		return nil, nil
+	}
+
+	b := &bodyMatcherRuntime{}
+	if body.Regex != nil {
+		re, err := regexp.Compile(*body.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex in matcher body, reason: %w", err)
+		}
+		b.regex = re
+	}
+
+	j, err := validateJSONPredicates(body.JSON, "matcher body json")
+	if err != nil {
+		return nil, err
+	}
+	b.json = j
+
+	for _, f := range body.Form {
+		if f.Name == "" {
+			return nil, fmt.Errorf("must specify a name in matcher body form")
+		}
+		if f.Equals == nil && f.Regex == nil {
+			return nil, fmt.Errorf("at least one of equals or regex must be specified in matcher body form")
+		}
+		fr := &formPredicateRuntime{name: f.Name, equals: f.Equals}
+		if f.Regex != nil {
+			re, err := regexp.Compile(*f.Regex)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regex in matcher body form, reason: %w", err)
+			}
+			fr.regex = re
+		}
+		b.form = append(b.form, fr)
+	}
+
+	if b.regex == nil && len(b.json) == 0 && len(b.form) == 0 {
+		return nil, fmt.Errorf("at least one of regex, json or form must be specified in matcher body")
+	}
+
+	return b, nil
+}
+
+// match returns true if the request body satisfies all the conditions.
+// Bodies which cannot be read in full never match.
+func (b *bodyMatcherRuntime) match(state *requestState) bool {
+	body, err := state.readBody()
+	if err != nil {
+		return false
+	}
+
+	if b.regex != nil && !b.regex.Match(body) {
+		return false
+	}
+
+	if len(b.json) > 0 {
+		var doc any
+		if json.Unmarshal(body, &doc) != nil || !matchJSONPredicates(b.json, doc) {
+			return false
+		}
+	}
+
+	if len(b.form) > 0 {
+		ct, _, _ := mime.ParseMediaType(state.req.Header.Get("Content-Type"))
+		if ct != "application/x-www-form-urlencoded" {
+			return false
+		}
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return false
+		}
+		for _, f := range b.form {
+			if !f.match(values) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func (f *formPredicateRuntime) match(values url.Values) bool {
+	if _, ok := values[f.name]; !ok {
+		return false
+	}
+	v := values.Get(f.name)
+	if f.equals != nil && v != *f.equals {
+		return false
+	}
+	if f.regex != nil && !f.regex.MatchString(v) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,108 @@
+package traefik_inline_response
+
+import (
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Chunked is the configuration for streaming the response body in
+// explicitly specified chunks, optionally followed by trailers.
+type Chunked struct {
+	Chunks   []Chunk           `json:"chunks" mapstructure:"chunks"`
+	Trailers map[string]string `json:"trailers" mapstructure:"trailers"`
+}
+
+// Chunk is a part of the body flushed to the client after waiting for the
+// delay (if any).
+type Chunk struct {
+	Data  string  `json:"data" mapstructure:"data"`
+	Delay *string `json:"delay" mapstructure:"delay"`
+}
+
+type chunkedRuntime struct {
+	chunks       []*chunkRuntime
+	trailerNames []string
+	trailers     map[string]string
+}
+
+type chunkRuntime struct {
+	data  []byte
+	delay time.Duration
+}
+
+func validateChunked(chunked *Chunked, loc string) (*chunkedRuntime, error) {
+	if len(chunked.Chunks) == 0 {
+		return nil, fmt.Errorf("must specify at least one chunk in %s response chunked", loc)
+	}
+
+	c := &chunkedRuntime{trailers: make(map[string]string)}
+	for _, ch := range chunked.Chunks {
+		cr := &chunkRuntime{data: []byte(ch.Data)}
+		if ch.Delay != nil {
+			d, err := time.ParseDuration(*ch.Delay)
+			if err != nil {
+				return nil, fmt.Errorf("invalid delay in %s response chunk, reason: %w", loc, err)
+			}
+			if d < 0 {
+				return nil, fmt.Errorf("delay in %s response chunk cannot be negative", loc)
+			}
+			cr.delay = d
+		}
+		c.chunks = append(c.chunks, cr)
+	}
+
+	for name, value := range chunked.Trailers {
+		if name == "" || strings.ContainsAny(name, " :\r\n") {
+			return nil, fmt.Errorf("invalid trailer name %q in %s response chunked", name, loc)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, fmt.Errorf("value of trailer %q in %s response chunked cannot contain line breaks", name, loc)
+		}
+		canonical := textproto.CanonicalMIMEHeaderKey(name)
+		c.trailerNames = append(c.trailerNames, canonical)
+		c.trailers[canonical] = value
+	}
+	sort.Strings(c.trailerNames)
+
+	return c, nil
+}
+
+// stream writes every chunk after its delay and flushes it, so that the
+// chunks are sent using the chunked transfer encoding as configured. The
+// trailers are declared up front using the Trailer header and sent after
+// the last chunk.
+func (c *chunkedRuntime) stream(req *http.Request, writer http.ResponseWriter, statusCode int) error {
+	flusher, ok := writer.(http.Flusher)
+	if !ok {
+		return fmt.Errorf("response writer does not support flushing, required for chunked")
+	}
+
+	if len(c.trailerNames) > 0 {
+		writer.Header().Set("Trailer", strings.Join(c.trailerNames, ", "))
+	}
+	writer.WriteHeader(statusCode)
+	flusher.Flush()
+
+	for _, ch := range c.chunks {
+		if !sleep(req.Context(), ch.delay) {
+			return nil
+		}
+		if len(ch.data) == 0 {
+			continue
+		}
+		_, err := writer.Write(ch.data)
+		if err != nil {
+			return nil
+		}
+		flusher.Flush()
+	}
+
+	for _, name := range c.trailerNames {
+		writer.Header().Set(name, c.trailers[name])
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package traefik_inline_response
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientIP is the configuration for resolving the client IP of requests
+// forwarded by proxies.
+type ClientIP struct {
+	Header         *string  `json:"header" mapstructure:"header"`
+	Depth          *int     `json:"depth" mapstructure:"depth"`
+	TrustedProxies []string `json:"trustedProxies" mapstructure:"trustedProxies"`
+}
+
+// SourceIPMatcher matches the resolved client IP against the allowed and
+// denied CIDRs.
+type SourceIPMatcher struct {
+	Allow []string `json:"allow" mapstructure:"allow"`
+	Deny  []string `json:"deny" mapstructure:"deny"`
+}
+
+const (
+	forwardedForHeader = "X-Forwarded-For"
+	realIPHeader       = "X-Real-Ip"
+)
+
+type clientIPRuntime struct {
+	header         string
+	depth          int
+	trustedProxies []*net.IPNet
+}
+
+type sourceIPMatcherRuntime struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+func validateClientIP(cip *ClientIP) (*clientIPRuntime, error) {
+	if cip == nil {
+		return nil, nil
+	}
+
+	c := &clientIPRuntime{header: forwardedForHeader}
+	if cip.Header != nil {
+		c.header = http.CanonicalHeaderKey(*cip.Header)
+		if c.header != forwardedForHeader && c.header != realIPHeader {
+			return nil, fmt.Errorf("invalid header %q in client IP, must be one of %q or %q", *cip.Header, forwardedForHeader, "X-Real-IP")
+		}
+	}
+	if cip.Depth != nil {
+		if c.header != forwardedForHeader {
+			return nil, fmt.Errorf("cannot specify depth in client IP when header is %q", *cip.Header)
+		}
+		if *cip.Depth <= 0 {
+			return nil, fmt.Errorf("depth must be positive in client IP")
+		}
+		c.depth = *cip.Depth
+	}
+	proxies, err := parseCIDRs(cip.TrustedProxies, "client IP trusted proxies")
+	if err != nil {
+		return nil, err
+	}
+	c.trustedProxies = proxies
+
+	return c, nil
+}
+
+func validateSourceIPMatcher(sip *SourceIPMatcher) (*sourceIPMatcherRuntime, error) {
+	if sip == nil {
+		return nil, nil
+	}
+
+	if len(sip.Allow) == 0 && len(sip.Deny) == 0 {
+		return nil, fmt.Errorf("at least one of allow or deny must be specified in matcher source IP")
+	}
+	allow, err := parseCIDRs(sip.Allow, "matcher source IP allow")
+	if err != nil {
+		return nil, err
+	}
+	deny, err := parseCIDRs(sip.Deny, "matcher source IP deny")
+	if err != nil {
+		return nil, err
+	}
+	return &sourceIPMatcherRuntime{allow: allow, deny: deny}, nil
+}
+
+// parseCIDRs parses the CIDRs, treating plain IP addresses as single
+// address networks.
+func parseCIDRs(cidrs []string, loc string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, c := range cidrs {
+		if !strings.Contains(c, "/") {
+			ip := net.ParseIP(c)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP %q in %s", c, loc)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip = ip4
+				bits = 8 * net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q in %s, reason: %w", c, loc, err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// match returns true if the client IP is not denied, and is allowed when
+// an allow list is specified. Requests with an unparsable client IP never
+// match.
+func (m *sourceIPMatcherRuntime) match(state *requestState) bool {
+	ip := net.ParseIP(state.clientIP())
+	if ip == nil {
+		return false
+	}
+	if containsIP(m.deny, ip) {
+		return false
+	}
+	return len(m.allow) == 0 || containsIP(m.allow, ip)
+}
+
+// resolve returns the client IP of the request. The forwarding headers are
+// only used when the peer is a trusted proxy, or when no trusted proxies
+// are configured. The peer address is used when the headers are absent or
+// invalid.
+func (c *clientIPRuntime) resolve(req *http.Request) string {
+	remote := remoteIP(req)
+	if c == nil {
+		return remote
+	}
+	if len(c.trustedProxies) > 0 {
+		ip := net.ParseIP(remote)
+		if ip == nil || !containsIP(c.trustedProxies, ip) {
+			return remote
+		}
+	}
+
+	if c.header == realIPHeader {
+		v := strings.TrimSpace(req.Header.Get(realIPHeader))
+		if net.ParseIP(v) == nil {
+			return remote
+		}
+		return v
+	}
+
+	var hops []string
+	for _, v := range req.Header.Values(forwardedForHeader) {
+		for _, hop := range strings.Split(v, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	if len(hops) == 0 {
+		return remote
+	}
+
+	if c.depth > 0 || len(c.trustedProxies) == 0 {
+		depth := c.depth
+		if depth == 0 {
+			depth = 1
+		}
+		if depth > len(hops) || net.ParseIP(hops[len(hops)-depth]) == nil {
+			return remote
+		}
+		return hops[len(hops)-depth]
+	}
+
+	// Skip the trusted proxies from the right, the first untrusted hop is
+	// the client.
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(hops[i])
+		if ip == nil {
+			return remote
+		}
+		if i == 0 || !containsIP(c.trustedProxies, ip) {
+			return hops[i]
+		}
+	}
+	return remote
+}
+
+// remoteIP returns the IP of the peer which sent the request.
+func remoteIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
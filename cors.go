@@ -0,0 +1,213 @@
+package traefik_inline_response
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// CORS is the configuration for answering CORS preflight requests and
+// decorating the inline responses with the CORS headers.
+type CORS struct {
+	AllowedOrigins       []string `json:"allowedOrigins" mapstructure:"allowedOrigins"`
+	AllowedOriginRegexes []string `json:"allowedOriginRegexes" mapstructure:"allowedOriginRegexes"`
+	AllowedMethods       []string `json:"allowedMethods" mapstructure:"allowedMethods"`
+	AllowedHeaders       []string `json:"allowedHeaders" mapstructure:"allowedHeaders"`
+	ExposedHeaders       []string `json:"exposedHeaders" mapstructure:"exposedHeaders"`
+	AllowCredentials     bool     `json:"allowCredentials" mapstructure:"allowCredentials"`
+	MaxAge               *int     `json:"maxAge" mapstructure:"maxAge"`
+}
+
+const corsAllowAll = "*"
+
+var defaultCORSMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+
+type corsRuntime struct {
+	allowAllOrigins  bool
+	origins          []string
+	originRegexes    []*regexp.Regexp
+	methods          []string
+	allowAllHeaders  bool
+	headers          []string
+	exposedHeaders   string
+	allowCredentials bool
+	maxAge           *int
+}
+
+func validateCORS(cors *CORS) (*corsRuntime, error) {
+	if cors == nil {
+		return nil, nil
+	}
+
+	if len(cors.AllowedOrigins) == 0 && len(cors.AllowedOriginRegexes) == 0 {
+		return nil, fmt.Errorf("at least one of allowed origins or allowed origin regexes must be specified in cors")
+	}
+	c := &corsRuntime{
+		methods:          defaultCORSMethods,
+		exposedHeaders:   strings.Join(cors.ExposedHeaders, ", "),
+		allowCredentials: cors.AllowCredentials,
+		maxAge:           cors.MaxAge,
+	}
+	for _, o := range cors.AllowedOrigins {
+		if o == corsAllowAll {
+			c.allowAllOrigins = true
+			continue
+		}
+		c.origins = append(c.origins, o)
+	}
+	for _, r := range cors.AllowedOriginRegexes {
+		_, err := regexp.Compile(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed origin regex %q in cors, reason: %w", r, err)
+		}
+		// Anchor the regex to the whole origin, so that the allowed origins
+		// cannot be spoofed with a suffix or a prefix.
+		c.originRegexes = append(c.originRegexes, regexp.MustCompile(`^(?:`+r+`)$`))
+	}
+	if len(cors.AllowedMethods) > 0 {
+		c.methods = nil
+		for _, m := range cors.AllowedMethods {
+			c.methods = append(c.methods, strings.ToUpper(m))
+		}
+	}
+	for _, h := range cors.AllowedHeaders {
+		if h == corsAllowAll {
+			c.allowAllHeaders = true
+			continue
+		}
+		c.headers = append(c.headers, http.CanonicalHeaderKey(h))
+	}
+	if cors.MaxAge != nil && *cors.MaxAge < 0 {
+		return nil, fmt.Errorf("max age must not be negative in cors")
+	}
+
+	return c, nil
+}
+
+// isCORSPreflight returns true if the request is a CORS preflight request.
+func isCORSPreflight(req *http.Request) bool {
+	return req.Method == http.MethodOptions &&
+		req.Header.Get("Origin") != "" &&
+		req.Header.Get("Access-Control-Request-Method") != ""
+}
+
+func (c *corsRuntime) allowOrigin(origin string) bool {
+	if c.allowAllOrigins {
+		return true
+	}
+	for _, o := range c.origins {
+		if o == origin {
+			return true
+		}
+	}
+	for _, re := range c.originRegexes {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *corsRuntime) allowMethod(method string) bool {
+	for _, m := range c.methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// allowHeaders returns true if all the headers in the comma separated list
+// are allowed. Any header is allowed when the allowed headers were not
+// configured.
+func (c *corsRuntime) allowHeaders(headers string) bool {
+	if c.allowAllHeaders || len(c.headers) == 0 {
+		return true
+	}
+	for _, h := range strings.Split(headers, ",") {
+		h = strings.TrimSpace(h)
+		if h == "" {
+			continue
+		}
+		allowed := false
+		for _, a := range c.headers {
+			if strings.EqualFold(a, h) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	return true
+}
+
+// echoesOrigin returns true if the allowed origin header echoes the
+// request's origin, which is the case unless all origins are allowed
+// without credentials.
+func (c *corsRuntime) echoesOrigin() bool {
+	return !c.allowAllOrigins || c.allowCredentials
+}
+
+func (c *corsRuntime) setAllowOrigin(header http.Header, origin string) {
+	if c.echoesOrigin() {
+		header.Set("Access-Control-Allow-Origin", origin)
+	} else {
+		header.Set("Access-Control-Allow-Origin", corsAllowAll)
+	}
+	if c.allowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// decorate adds the CORS headers for the request's origin to the headers
+// of an inline response.
+func (c *corsRuntime) decorate(header http.Header, req *http.Request) {
+	if c == nil {
+		return
+	}
+	origin := req.Header.Get("Origin")
+	if c.echoesOrigin() {
+		header.Add("Vary", "Origin")
+	}
+	if origin == "" || !c.allowOrigin(origin) {
+		return
+	}
+	c.setAllowOrigin(header, origin)
+	if c.exposedHeaders != "" {
+		header.Set("Access-Control-Expose-Headers", c.exposedHeaders)
+	}
+}
+
+// servePreflight answers the CORS preflight request. The CORS headers are
+// left out if the origin, method or headers are not allowed, which makes
+// the browser fail the actual request.
+func (c *corsRuntime) servePreflight(writer http.ResponseWriter, req *http.Request) {
+	header := writer.Header()
+	header.Add("Vary", "Origin, Access-Control-Request-Method, Access-Control-Request-Headers")
+
+	origin := req.Header.Get("Origin")
+	method := req.Header.Get("Access-Control-Request-Method")
+	requested := req.Header.Get("Access-Control-Request-Headers")
+	if !c.allowOrigin(origin) || !c.allowMethod(method) || !c.allowHeaders(requested) {
+		writer.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	c.setAllowOrigin(header, origin)
+	header.Set("Access-Control-Allow-Methods", strings.Join(c.methods, ", "))
+	if requested != "" {
+		if c.allowAllHeaders || len(c.headers) == 0 {
+			header.Set("Access-Control-Allow-Headers", requested)
+		} else {
+			header.Set("Access-Control-Allow-Headers", strings.Join(c.headers, ", "))
+		}
+	}
+	if c.maxAge != nil {
+		header.Set("Access-Control-Max-Age", strconv.Itoa(*c.maxAge))
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
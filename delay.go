@@ -0,0 +1,144 @@
+package traefik_inline_response
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Delay is the configuration for the latency injected before responding
+// to a request. Exactly one of a fixed delay, a uniformly distributed
+// delay within a range, or a normally distributed delay can be specified.
+type Delay struct {
+	Fixed  *string `json:"fixed" mapstructure:"fixed"`
+	Min    *string `json:"min" mapstructure:"min"`
+	Max    *string `json:"max" mapstructure:"max"`
+	Mean   *string `json:"mean" mapstructure:"mean"`
+	StdDev *string `json:"stdDev" mapstructure:"stdDev"`
+}
+
+const (
+	delayModeUnknown = iota
+	delayModeFixed
+	delayModeUniform
+	delayModeNormal
+)
+
+type delayMode uint8
+
+type delayRuntime struct {
+	mode   delayMode
+	fixed  time.Duration
+	min    time.Duration
+	max    time.Duration
+	mean   time.Duration
+	stdDev time.Duration
+}
+
+func validateDelay(delay *Delay, loc string) (*delayRuntime, error) {
+	if delay == nil {
+		return nil, nil
+	}
+
+	d := &delayRuntime{}
+	var err error
+	if delay.Fixed != nil {
+		if delay.Min != nil || delay.Max != nil {
+			return nil, fmt.Errorf("cannot specify min or max in %s delay when fixed is specified", loc)
+		}
+		if delay.Mean != nil || delay.StdDev != nil {
+			return nil, fmt.Errorf("cannot specify mean or std dev in %s delay when fixed is specified", loc)
+		}
+		d.mode = delayModeFixed
+		d.fixed, err = parseDelayDuration(*delay.Fixed, "fixed", loc)
+		if err != nil {
+			return nil, err
+		}
+	} else if delay.Min != nil || delay.Max != nil {
+		if delay.Min == nil || delay.Max == nil {
+			return nil, fmt.Errorf("must specify both min and max in %s delay", loc)
+		}
+		if delay.Mean != nil || delay.StdDev != nil {
+			return nil, fmt.Errorf("cannot specify mean or std dev in %s delay when min and max are specified", loc)
+		}
+		d.mode = delayModeUniform
+		d.min, err = parseDelayDuration(*delay.Min, "min", loc)
+		if err != nil {
+			return nil, err
+		}
+		d.max, err = parseDelayDuration(*delay.Max, "max", loc)
+		if err != nil {
+			return nil, err
+		}
+		if d.max < d.min {
+			return nil, fmt.Errorf("max cannot be less than min in %s delay", loc)
+		}
+	} else if delay.Mean != nil || delay.StdDev != nil {
+		if delay.Mean == nil || delay.StdDev == nil {
+			return nil, fmt.Errorf("must specify both mean and std dev in %s delay", loc)
+		}
+		d.mode = delayModeNormal
+		d.mean, err = parseDelayDuration(*delay.Mean, "mean", loc)
+		if err != nil {
+			return nil, err
+		}
+		d.stdDev, err = parseDelayDuration(*delay.StdDev, "std dev", loc)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, fmt.Errorf("at least one of fixed, min and max, or mean and std dev must be specified in %s delay", loc)
+	}
+
+	return d, nil
+}
+
+func parseDelayDuration(value string, field string, loc string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s in %s delay, reason: %w", field, loc, err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("%s in %s delay cannot be negative", field, loc)
+	}
+	return d, nil
+}
+
+// duration returns the delay to inject for a single request.
+func (d *delayRuntime) duration(random *randomSource) time.Duration {
+	switch d.mode {
+	case delayModeFixed:
+		return d.fixed
+	case delayModeUniform:
+		if d.max == d.min {
+			return d.min
+		}
+		return d.min + time.Duration(random.int63n(int64(d.max-d.min)+1))
+	case delayModeNormal:
+		result := d.mean + time.Duration(random.normFloat64()*float64(d.stdDev))
+		if result < 0 {
+			return 0
+		}
+		return result
+	default:
+		return 0
+	}
+}
+
+// sleep waits for the specified duration, returning false if the context
+// was canceled in the meantime.
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,247 @@
+package traefik_inline_response
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Fault is the configuration for injecting faults while writing the
+// response, for testing the robustness of the clients. TruncateAt is the
+// number of bytes of the body written before the connection is closed, and
+// is clamped so that at least the last byte of the body is always cut.
+type Fault struct {
+	Mode          *string  `json:"mode" mapstructure:"mode"`
+	Probability   *float64 `json:"probability" mapstructure:"probability"`
+	TruncateAt    *int     `json:"truncateAt" mapstructure:"truncateAt"`
+	ContentLength *int     `json:"contentLength" mapstructure:"contentLength"`
+	DripBytes     *int     `json:"dripBytes" mapstructure:"dripBytes"`
+	DripInterval  *string  `json:"dripInterval" mapstructure:"dripInterval"`
+}
+
+const (
+	faultModeNameReset         = "reset"
+	faultModeNameTruncate      = "truncate"
+	faultModeNameContentLength = "contentLength"
+	faultModeNameDrip          = "drip"
+)
+
+const (
+	faultModeUnknown = iota
+	faultModeReset
+	faultModeTruncate
+	faultModeContentLength
+	faultModeDrip
+)
+
+type faultMode uint8
+
+type faultRuntime struct {
+	mode          faultMode
+	probability   float64
+	truncateAt    *int
+	contentLength *int
+	dripBytes     int
+	dripInterval  time.Duration
+}
+
+func validateFault(fault *Fault, loc string) (*faultRuntime, error) {
+	if fault == nil {
+		return nil, nil
+	}
+
+	f := &faultRuntime{
+		probability: 100,
+		dripBytes:   1,
+	}
+
+	if fault.Mode == nil {
+		return nil, fmt.Errorf("must specify a mode in %s response fault", loc)
+	}
+	switch *fault.Mode {
+	case faultModeNameReset:
+		f.mode = faultModeReset
+	case faultModeNameTruncate:
+		f.mode = faultModeTruncate
+	case faultModeNameContentLength:
+		f.mode = faultModeContentLength
+	case faultModeNameDrip:
+		f.mode = faultModeDrip
+	default:
+		return nil, fmt.Errorf("invalid mode %q in %s response fault, must be one of %q, %q, %q or %q", *fault.Mode, loc, faultModeNameReset, faultModeNameTruncate, faultModeNameContentLength, faultModeNameDrip)
+	}
+
+	if fault.Probability != nil {
+		if *fault.Probability < 0 || *fault.Probability > 100 {
+			return nil, fmt.Errorf("probability in %s response fault must be between 0 and 100", loc)
+		}
+		f.probability = *fault.Probability
+	}
+
+	if fault.TruncateAt != nil {
+		if f.mode != faultModeTruncate {
+			return nil, fmt.Errorf("can only specify truncate at in %s response fault when mode is %q", loc, faultModeNameTruncate)
+		}
+		if *fault.TruncateAt < 0 {
+			return nil, fmt.Errorf("truncate at in %s response fault cannot be negative", loc)
+		}
+		f.truncateAt = fault.TruncateAt
+	}
+
+	if fault.ContentLength != nil {
+		if f.mode != faultModeContentLength {
+			return nil, fmt.Errorf("can only specify content length in %s response fault when mode is %q", loc, faultModeNameContentLength)
+		}
+		if *fault.ContentLength < 0 {
+			return nil, fmt.Errorf("content length in %s response fault cannot be negative", loc)
+		}
+		f.contentLength = fault.ContentLength
+	}
+
+	if fault.DripBytes != nil {
+		if f.mode != faultModeDrip {
+			return nil, fmt.Errorf("can only specify drip bytes in %s response fault when mode is %q", loc, faultModeNameDrip)
+		}
+		if *fault.DripBytes <= 0 {
+			return nil, fmt.Errorf("drip bytes in %s response fault must be positive", loc)
+		}
+		f.dripBytes = *fault.DripBytes
+	}
+
+	if fault.DripInterval != nil {
+		if f.mode != faultModeDrip {
+			return nil, fmt.Errorf("can only specify drip interval in %s response fault when mode is %q", loc, faultModeNameDrip)
+		}
+		d, err := time.ParseDuration(*fault.DripInterval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid drip interval in %s response fault, reason: %w", loc, err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("drip interval in %s response fault must be positive", loc)
+		}
+		f.dripInterval = d
+	} else if f.mode == faultModeDrip {
+		return nil, fmt.Errorf("must specify drip interval in %s response fault when mode is %q", loc, faultModeNameDrip)
+	}
+
+	return f, nil
+}
+
+// triggered determines whether the fault must be injected for a single
+// request based on the configured probability.
+func (f *faultRuntime) triggered(random *randomSource) bool {
+	if f.probability >= 100 {
+		return true
+	}
+	return random.float64()*100 < f.probability
+}
+
+// inject writes the response with the configured fault. Errors are only
+// returned if nothing has been written to the client yet.
+func (f *faultRuntime) inject(req *http.Request, writer http.ResponseWriter, statusCode int, body []byte) error {
+	switch f.mode {
+	case faultModeReset:
+		conn, _, err := hijack(writer)
+		if err != nil {
+			return err
+		}
+		if tcp, ok := conn.(*net.TCPConn); ok {
+			// Discard any unsent data and send a RST instead of a FIN.
+			//nolint:errcheck
+			tcp.SetLinger(0)
+		}
+		//nolint:errcheck
+		conn.Close()
+		return nil
+	case faultModeTruncate:
+		n := len(body) / 2
+		if f.truncateAt != nil {
+			n = *f.truncateAt
+		}
+		if n >= len(body) && len(body) > 0 {
+			// Always cut at least the last byte, so that the body is
+			// never written in full.
+			n = len(body) - 1
+		}
+		return writeRawResponse(writer, statusCode, len(body), body[:n])
+	case faultModeContentLength:
+		length := len(body) + 1
+		if f.contentLength != nil {
+			length = *f.contentLength
+		}
+		return writeRawResponse(writer, statusCode, length, body)
+	case faultModeDrip:
+		return f.drip(req, writer, statusCode, body)
+	default:
+		return fmt.Errorf("invalid fault mode, indicating a bug in the plugin")
+	}
+}
+
+// drip trickles the body to the client a few bytes at a time, stopping
+// early if the client goes away.
+func (f *faultRuntime) drip(req *http.Request, writer http.ResponseWriter, statusCode int, body []byte) error {
+	flusher, ok := writer.(http.Flusher)
+	if !ok {
+		return fmt.Errorf("response writer does not support flushing, required for the drip fault")
+	}
+
+	writer.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	writer.WriteHeader(statusCode)
+	flusher.Flush()
+
+	for len(body) > 0 {
+		if !sleep(req.Context(), f.dripInterval) {
+			return nil
+		}
+		n := f.dripBytes
+		if n > len(body) {
+			n = len(body)
+		}
+		_, err := writer.Write(body[:n])
+		if err != nil {
+			return nil
+		}
+		flusher.Flush()
+		body = body[n:]
+	}
+	return nil
+}
+
+func hijack(writer http.ResponseWriter) (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := writer.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking the connection")
+	}
+	return hj.Hijack()
+}
+
+// writeRawResponse hijacks the connection, writes an HTTP/1.1 response
+// declaring the specified content length along with the body as is, and
+// closes the connection abruptly.
+func writeRawResponse(writer http.ResponseWriter, statusCode int, contentLength int, body []byte) error {
+	conn, rw, err := hijack(writer)
+	if err != nil {
+		return err
+	}
+	//nolint:errcheck
+	defer conn.Close()
+
+	header := writer.Header().Clone()
+	header.Set("Content-Length", strconv.Itoa(contentLength))
+	header.Set("Connection", "close")
+
+	//nolint:errcheck
+	fmt.Fprintf(rw, "HTTP/1.1 %d %s\r\n", statusCode, http.StatusText(statusCode))
+	//nolint:errcheck
+	header.Write(rw)
+	//nolint:errcheck
+	rw.WriteString("\r\n")
+	//nolint:errcheck
+	rw.Write(body)
+	//nolint:errcheck
+	rw.Flush()
+	return nil
+}
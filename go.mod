@@ -6,3 +6,5 @@ require (
 	github.com/mitchellh/mapstructure v1.5.0
 	gopkg.in/yaml.v3 v3.0.1
 )
+
+require golang.org/x/crypto v0.33.0
@@ -0,0 +1,303 @@
+package traefik_inline_response
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// GraphQLMatcher is a set of conditions on the GraphQL operation in the
+// request, all of which must be satisfied for the matcher to match the
+// request.
+type GraphQLMatcher struct {
+	OperationName *string         `json:"operationName" mapstructure:"operationName"`
+	OperationType *string         `json:"operationType" mapstructure:"operationType"`
+	Variables     []JSONPredicate `json:"variables" mapstructure:"variables"`
+}
+
+const (
+	graphQLOperationTypeQuery        = "query"
+	graphQLOperationTypeMutation     = "mutation"
+	graphQLOperationTypeSubscription = "subscription"
+)
+
+type graphQLMatcherRuntime struct {
+	operationName *string
+	operationType *string
+	variables     []*jsonPredicateRuntime
+}
+
+// graphQLOperation is the operation parsed from a GraphQL request, which
+// is also made available to the templates.
+type graphQLOperation struct {
+	Query         string
+	OperationName string
+	OperationType string
+	Variables     map[string]any
+}
+
+type graphQLRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+type graphQLDefinition struct {
+	opType string
+	name   string
+}
+
+func validateGraphQLMatcher(gql *GraphQLMatcher) (*graphQLMatcherRuntime, error) {
+	if gql == nil {
+		return nil, nil
+	}
+
+	g := &graphQLMatcherRuntime{
+		operationName: gql.OperationName,
+	}
+	if gql.OperationType != nil {
+		switch *gql.OperationType {
+		case graphQLOperationTypeQuery, graphQLOperationTypeMutation, graphQLOperationTypeSubscription:
+		default:
+			return nil, fmt.Errorf("invalid operation type %q in matcher graphql, must be one of %q, %q or %q", *gql.OperationType, graphQLOperationTypeQuery, graphQLOperationTypeMutation, graphQLOperationTypeSubscription)
+		}
+		g.operationType = gql.OperationType
+	}
+
+	v, err := validateJSONPredicates(gql.Variables, "matcher graphql variables")
+	if err != nil {
+		return nil, err
+	}
+	g.variables = v
+
+	return g, nil
+}
+
+func (g *graphQLMatcherRuntime) match(state *requestState) bool {
+	op := state.graphQL()
+	if op == nil {
+		return false
+	}
+	if g.operationName != nil && op.OperationName != *g.operationName {
+		return false
+	}
+	if g.operationType != nil && op.OperationType != *g.operationType {
+		return false
+	}
+	if len(g.variables) > 0 {
+		var vars any = op.Variables
+		if op.Variables == nil {
+			vars = map[string]any{}
+		}
+		if !matchJSONPredicates(g.variables, vars) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseGraphQLRequest extracts the GraphQL operation from a GET request
+// with the query parameters, or from a POST request with either a JSON or
+// an application/graphql body. It returns nil if the request is not a
+// valid GraphQL request.
+func parseGraphQLRequest(state *requestState) *graphQLOperation {
+	req := state.req
+	gr := &graphQLRequest{}
+
+	switch req.Method {
+	case http.MethodGet:
+		q := req.URL.Query()
+		gr.Query = q.Get("query")
+		gr.OperationName = q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			if json.Unmarshal([]byte(v), &gr.Variables) != nil {
+				return nil
+			}
+		}
+	case http.MethodPost:
+		body, err := state.readBody()
+		if err != nil {
+			return nil
+		}
+		ct, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+		if ct == "application/graphql" {
+			gr.Query = string(body)
+			gr.OperationName = req.URL.Query().Get("operationName")
+		} else if json.Unmarshal(body, gr) != nil {
+			return nil
+		}
+	default:
+		return nil
+	}
+
+	if strings.TrimSpace(gr.Query) == "" {
+		return nil
+	}
+
+	def, ok := selectGraphQLOperation(parseGraphQLDefinitions(gr.Query), gr.OperationName)
+	if !ok {
+		return nil
+	}
+
+	return &graphQLOperation{
+		Query:         gr.Query,
+		OperationName: def.name,
+		OperationType: def.opType,
+		Variables:     gr.Variables,
+	}
+}
+
+// selectGraphQLOperation picks the operation to execute as per the
+// GraphQL spec, i.e. the operation with the specified name, or the only
+// operation in the document if no name is specified.
+func selectGraphQLOperation(defs []graphQLDefinition, name string) (graphQLDefinition, bool) {
+	if name == "" {
+		if len(defs) != 1 {
+			return graphQLDefinition{}, false
+		}
+		return defs[0], true
+	}
+	for _, d := range defs {
+		if d.name == name {
+			return d, true
+		}
+	}
+	return graphQLDefinition{}, false
+}
+
+// parseGraphQLDefinitions returns the type and the name of the operations
+// defined in the GraphQL document. Only the top level of the document is
+// inspected, the selection sets are skipped.
+func parseGraphQLDefinitions(doc string) []graphQLDefinition {
+	var defs []graphQLDefinition
+	lex := &graphQLLexer{src: doc}
+	braces, parens := 0, 0
+	atDefStart := true
+
+	for {
+		tok, ok := lex.next()
+		if !ok {
+			return defs
+		}
+
+		if braces == 0 && parens == 0 && atDefStart {
+			atDefStart = false
+			switch tok {
+			case graphQLOperationTypeQuery, graphQLOperationTypeMutation, graphQLOperationTypeSubscription:
+				def := graphQLDefinition{opType: tok}
+				if name, ok := lex.peek(); ok && isGraphQLName(name) {
+					def.name = name
+					lex.next()
+				}
+				defs = append(defs, def)
+				continue
+			case "{":
+				// Shorthand query without the operation type and name.
+				defs = append(defs, graphQLDefinition{opType: graphQLOperationTypeQuery})
+			}
+		}
+
+		switch tok {
+		case "{":
+			braces++
+		case "}":
+			braces--
+			if braces == 0 && parens == 0 {
+				atDefStart = true
+			}
+		case "(":
+			parens++
+		case ")":
+			parens--
+		}
+	}
+}
+
+func isGraphQLName(tok string) bool {
+	if tok == "" {
+		return false
+	}
+	c := tok[0]
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// graphQLLexer is a minimal GraphQL lexer returning names and punctuators,
+// while skipping whitespace, commas, comments, strings and numbers.
+type graphQLLexer struct {
+	src string
+	pos int
+}
+
+func (l *graphQLLexer) peek() (string, bool) {
+	pos := l.pos
+	tok, ok := l.next()
+	l.pos = pos
+	return tok, ok
+}
+
+func (l *graphQLLexer) next() (string, bool) {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			l.pos++
+		case c == '#':
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' && l.src[l.pos] != '\r' {
+				l.pos++
+			}
+		case c == '"':
+			l.skipString()
+		case isGraphQLName(string(c)):
+			start := l.pos
+			for l.pos < len(l.src) && isGraphQLNameChar(l.src[l.pos]) {
+				l.pos++
+			}
+			return l.src[start:l.pos], true
+		case strings.IndexByte("{}()[]:=@$!|&", c) >= 0:
+			l.pos++
+			return string(c), true
+		default:
+			// Numbers, spreads and anything else irrelevant for locating
+			// the operations.
+			l.pos++
+		}
+	}
+	return "", false
+}
+
+func isGraphQLNameChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func (l *graphQLLexer) skipString() {
+	if strings.HasPrefix(l.src[l.pos:], `"""`) {
+		l.pos += 3
+		for l.pos < len(l.src) {
+			if strings.HasPrefix(l.src[l.pos:], `\"""`) {
+				l.pos += 4
+				continue
+			}
+			if strings.HasPrefix(l.src[l.pos:], `"""`) {
+				l.pos += 3
+				return
+			}
+			l.pos++
+		}
+		return
+	}
+
+	l.pos++
+	for l.pos < len(l.src) {
+		switch l.src[l.pos] {
+		case '\\':
+			l.pos += 2
+		case '"', '\n', '\r':
+			l.pos++
+			return
+		default:
+			l.pos++
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package traefik_inline_response
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// GRPCMatcher is the condition for matching a gRPC or a gRPC-Web request.
+type GRPCMatcher struct {
+	Method *string `json:"method" mapstructure:"method"`
+}
+
+// GRPC is the configuration for responding to a unary gRPC call. The
+// message is the base64 encoded protobuf message. When the message is not
+// specified, a trailers-only response is sent.
+type GRPC struct {
+	Message       *string `json:"message" mapstructure:"message"`
+	Status        *int    `json:"status" mapstructure:"status"`
+	StatusMessage *string `json:"statusMessage" mapstructure:"statusMessage"`
+}
+
+const (
+	grpcContentType        = "application/grpc"
+	grpcWebContentType     = "application/grpc-web"
+	grpcWebTextContentType = "application/grpc-web-text"
+)
+
+// grpcMaxStatus is the highest status code defined by gRPC (UNAUTHENTICATED).
+const grpcMaxStatus = 16
+
+var grpcMethodRegex = regexp.MustCompile(`^/[^/]+/[^/]+$`)
+
+type grpcMatcherRuntime struct {
+	method string
+}
+
+type grpcRuntime struct {
+	message       []byte
+	hasMessage    bool
+	status        int
+	statusMessage string
+}
+
+func validateGRPCMatcher(g *GRPCMatcher) (*grpcMatcherRuntime, error) {
+	if g == nil {
+		return nil, nil
+	}
+
+	if g.Method == nil {
+		return nil, fmt.Errorf("must specify a method in matcher grpc")
+	}
+	if !grpcMethodRegex.MatchString(*g.Method) {
+		return nil, fmt.Errorf("invalid method %q in matcher grpc, must be of the form /package.Service/Method", *g.Method)
+	}
+
+	return &grpcMatcherRuntime{method: *g.Method}, nil
+}
+
+func validateGRPC(g *GRPC, loc string) (*grpcRuntime, error) {
+	r := &grpcRuntime{}
+
+	if g.Message != nil {
+		b, err := base64.StdEncoding.DecodeString(*g.Message)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 message in %s response grpc, reason: %w", loc, err)
+		}
+		r.message = b
+		r.hasMessage = true
+	}
+	if g.Status != nil {
+		if *g.Status < 0 || *g.Status > grpcMaxStatus {
+			return nil, fmt.Errorf("status in %s response grpc must be between 0 and %d", loc, grpcMaxStatus)
+		}
+		r.status = *g.Status
+	}
+	if g.StatusMessage != nil {
+		r.statusMessage = *g.StatusMessage
+	}
+
+	return r, nil
+}
+
+func (g *grpcMatcherRuntime) match(req *http.Request) bool {
+	return req.URL.Path == g.method && grpcContentTypeOf(req) != ""
+}
+
+// grpcContentTypeOf returns the gRPC flavor of the request based on its
+// content type, or an empty string if it is not a gRPC request.
+func grpcContentTypeOf(req *http.Request) string {
+	ct, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+	base, _, _ := strings.Cut(ct, "+")
+	switch base {
+	case grpcContentType, grpcWebContentType, grpcWebTextContentType:
+		return base
+	default:
+		return ""
+	}
+}
+
+// respond writes the message with the length-prefixed framing followed by
+// the status, using HTTP trailers for gRPC and a trailer frame for
+// gRPC-Web. Trailers-only responses carry the status in the headers.
+func (g *grpcRuntime) respond(req *http.Request, writer http.ResponseWriter, statusCode int) error {
+	flavor := grpcContentTypeOf(req)
+	if flavor == "" {
+		flavor = grpcContentType
+	}
+
+	header := writer.Header()
+	header.Set("Content-Type", flavor+"+proto")
+
+	if !g.hasMessage {
+		header.Set("Grpc-Status", strconv.Itoa(g.status))
+		if g.statusMessage != "" {
+			header.Set("Grpc-Message", grpcPercentEncode(g.statusMessage))
+		}
+		writer.WriteHeader(statusCode)
+		return nil
+	}
+
+	var body bytes.Buffer
+	writeGRPCFrame(&body, 0x00, g.message)
+
+	if flavor == grpcContentType {
+		header.Set("Trailer", "Grpc-Status, Grpc-Message")
+		writer.WriteHeader(statusCode)
+		_, err := writer.Write(body.Bytes())
+		header.Set("Grpc-Status", strconv.Itoa(g.status))
+		header.Set("Grpc-Message", grpcPercentEncode(g.statusMessage))
+		return err
+	}
+
+	var trailers bytes.Buffer
+	trailers.WriteString("grpc-status: " + strconv.Itoa(g.status) + "\r\n")
+	if g.statusMessage != "" {
+		trailers.WriteString("grpc-message: " + grpcPercentEncode(g.statusMessage) + "\r\n")
+	}
+	writeGRPCFrame(&body, 0x80, trailers.Bytes())
+
+	b := body.Bytes()
+	if flavor == grpcWebTextContentType {
+		b = []byte(base64.StdEncoding.EncodeToString(b))
+	}
+	writer.WriteHeader(statusCode)
+	_, err := writer.Write(b)
+	return err
+}
+
+// writeGRPCFrame writes the flags byte and the big endian length prefix
+// followed by the payload.
+func writeGRPCFrame(buf *bytes.Buffer, flags byte, payload []byte) {
+	var prefix [5]byte
+	prefix[0] = flags
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(payload)))
+	buf.Write(prefix[:])
+	buf.Write(payload)
+}
+
+// grpcPercentEncode encodes the status message as required by the gRPC
+// over HTTP/2 spec.
+func grpcPercentEncode(msg string) string {
+	var sb strings.Builder
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c >= 0x20 && c <= 0x7e && c != '%' {
+			sb.WriteByte(c)
+		} else {
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+	return sb.String()
+}
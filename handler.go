@@ -1,27 +1,69 @@
 package traefik_inline_response
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"html/template"
-	"io"
 	"net/http"
 	"os"
 	"regexp"
 	"strings"
+	"time"
 )
 
 // Config is the type that holds the configuration for this plugin.
 type Config struct {
-	Matchers []Matcher `json:"matchers" mapstructure:"matchers"`
-	Fallback *Fallback `json:"fallback" mapstructure:"fallback"`
-	Debug    bool      `json:"debug" mapstructure:"debug"`
+	Matchers          []Matcher      `json:"matchers" mapstructure:"matchers"`
+	Fallback          *Fallback      `json:"fallback" mapstructure:"fallback"`
+	RandomSeed        *int64         `json:"randomSeed" mapstructure:"randomSeed"`
+	ScenarioResetPath *string        `json:"scenarioResetPath" mapstructure:"scenarioResetPath"`
+	Store             *StoreConfig   `json:"store" mapstructure:"store"`
+	MaxBodySize       *int           `json:"maxBodySize" mapstructure:"maxBodySize"`
+	CORS              *CORS          `json:"cors" mapstructure:"cors"`
+	ClientIP          *ClientIP      `json:"clientIP" mapstructure:"clientIP"`
+	Maintenance       *Maintenance   `json:"maintenance" mapstructure:"maintenance"`
+	RateLimit         *RateLimit     `json:"rateLimit" mapstructure:"rateLimit"`
+	OIDC              *OIDCProvider  `json:"oidc" mapstructure:"oidc"`
+	ACME              *ACMEChallenge `json:"acme" mapstructure:"acme"`
+	Debug             bool           `json:"debug" mapstructure:"debug"`
 }
 
 type Matcher struct {
-	Path       Path     `json:"path" mapstructure:"path"`
+	Path       Path               `json:"path" mapstructure:"path"`
+	Methods    []string           `json:"methods" mapstructure:"methods"`
+	Body       *BodyMatcher       `json:"body" mapstructure:"body"`
+	GraphQL    *GraphQLMatcher    `json:"graphql" mapstructure:"graphql"`
+	JSONRPC    *JSONRPCMatcher    `json:"jsonrpc" mapstructure:"jsonrpc"`
+	GRPC       *GRPCMatcher       `json:"grpc" mapstructure:"grpc"`
+	SOAP       *SOAPMatcher       `json:"soap" mapstructure:"soap"`
+	SourceIP   *SourceIPMatcher   `json:"sourceIP" mapstructure:"sourceIP"`
+	JWT        *JWTMatcher        `json:"jwt" mapstructure:"jwt"`
+	StatusCode *int               `json:"statusCode" mapstructure:"statusCode"`
+	Resp       Response           `json:"response" mapstructure:"response"`
+	Responses  []WeightedResponse `json:"responses" mapstructure:"responses"`
+	Sequence   *Sequence          `json:"sequence" mapstructure:"sequence"`
+
+	Scenario      *string `json:"scenario" mapstructure:"scenario"`
+	RequiredState *string `json:"requiredState" mapstructure:"requiredState"`
+	NewState      *string `json:"newState" mapstructure:"newState"`
+
+	ActiveFrom  *string   `json:"activeFrom" mapstructure:"activeFrom"`
+	ActiveUntil *string   `json:"activeUntil" mapstructure:"activeUntil"`
+	Schedule    *Schedule `json:"schedule" mapstructure:"schedule"`
+
+	SampleRate *float64    `json:"sampleRate" mapstructure:"sampleRate"`
+	SampleKey  *RequestKey `json:"sampleKey" mapstructure:"sampleKey"`
+
+	Store     *StoreActions  `json:"store" mapstructure:"store"`
+	Delay     *Delay         `json:"delay" mapstructure:"delay"`
+	RateLimit *RateLimit     `json:"rateLimit" mapstructure:"rateLimit"`
+	BasicAuth *BasicAuth     `json:"basicAuth" mapstructure:"basicAuth"`
+	HMAC      *HMACSignature `json:"hmac" mapstructure:"hmac"`
+}
+
+type WeightedResponse struct {
+	Weight     *int     `json:"weight" mapstructure:"weight"`
 	StatusCode *int     `json:"statusCode" mapstructure:"statusCode"`
 	Resp       Response `json:"response" mapstructure:"response"`
 }
@@ -35,12 +77,20 @@ type Path struct {
 type Fallback struct {
 	StatusCode *int     `json:"statusCode" mapstructure:"statusCode"`
 	Resp       Response `json:"response" mapstructure:"response"`
+	Delay      *Delay   `json:"delay" mapstructure:"delay"`
 }
 
 type Response struct {
-	Raw      *string         `json:"data" mapstructure:"raw"`
-	Template *string         `json:"template" mapstructure:"template"`
-	JSON     *map[string]any `json:"json" mapstructure:"json"`
+	Raw          *string         `json:"data" mapstructure:"raw"`
+	Template     *string         `json:"template" mapstructure:"template"`
+	JSON         *map[string]any `json:"json" mapstructure:"json"`
+	SSE          *SSE            `json:"sse" mapstructure:"sse"`
+	WebSocket    *WebSocket      `json:"websocket" mapstructure:"websocket"`
+	Chunked      *Chunked        `json:"chunked" mapstructure:"chunked"`
+	JSONRPCError *JSONRPCError   `json:"jsonrpcError" mapstructure:"jsonrpcError"`
+	GRPC         *GRPC           `json:"grpc" mapstructure:"grpc"`
+	SOAP         *SOAP           `json:"soap" mapstructure:"soap"`
+	Fault        *Fault          `json:"fault" mapstructure:"fault"`
 }
 
 const (
@@ -58,17 +108,58 @@ const (
 	responseModeRaw
 	responseModeTemplate
 	responseModeJSON
+	responseModeSSE
+	responseModeWebSocket
+	responseModeChunked
+	responseModeJSONRPCError
+	responseModeGRPC
+	responseModeSOAP
+	responseModeOIDC
+	responseModeACME
 )
 
 type responseMode uint8
 
 type handlerRuntime struct {
-	matchers []*matcherRuntime
-	fallback *fallbackRuntime
+	matchers          []*matcherRuntime
+	fallback          *fallbackRuntime
+	scenarioResetPath *string
+	store             *kvStore
+	maxBodySize       int
+	hasJSONRPC        bool
+	cors              *corsRuntime
+	clientIP          *clientIPRuntime
+	maintenance       *maintenanceRuntime
+	rateLimit         *rateLimitRuntime
 }
 
 type matcherRuntime struct {
-	path       *pathRuntime
+	path        *pathRuntime
+	methods     []string
+	body        *bodyMatcherRuntime
+	graphQL     *graphQLMatcherRuntime
+	jsonRPC     *jsonRPCMatcherRuntime
+	grpc        *grpcMatcherRuntime
+	soap        *soapMatcherRuntime
+	sourceIP    *sourceIPMatcherRuntime
+	jwt         *jwtMatcherRuntime
+	schedule    *scheduleRuntime
+	sample      *sampleRuntime
+	rateLimit   *rateLimitRuntime
+	basicAuth   *basicAuthRuntime
+	hmac        *hmacSignatureRuntime
+	statusCode  int
+	resp        *responseRuntime
+	weighted    []*weightedResponseRuntime
+	totalWeight int
+	sequence    *sequenceRuntime
+	scenario    *scenarioRuntime
+	store       *storeActionsRuntime
+	delay       *delayRuntime
+}
+
+type weightedResponseRuntime struct {
+	weight     int
 	statusCode int
 	resp       *responseRuntime
 }
@@ -81,15 +172,25 @@ type pathRuntime struct {
 }
 
 type responseRuntime struct {
-	mode  responseMode
-	raw   string
-	templ *template.Template
-	json  string
+	mode         responseMode
+	raw          string
+	templ        *template.Template
+	json         string
+	sse          *sseRuntime
+	ws           *webSocketRuntime
+	chunked      *chunkedRuntime
+	jsonRPCError []byte
+	grpc         *grpcRuntime
+	soap         *soapRuntime
+	oidc         *oidcEndpointRuntime
+	acme         *acmeRuntime
+	fault        *faultRuntime
 }
 
 type fallbackRuntime struct {
 	statusCode int
 	resp       *responseRuntime
+	delay      *delayRuntime
 }
 
 func CreateConfig() *Config {
@@ -100,26 +201,179 @@ func CreateConfig() *Config {
 
 func (c *Config) validate() (*handlerRuntime, error) {
 	rt := &handlerRuntime{}
+
+	oidc, err := validateOIDCProvider(c.OIDC)
+	if err != nil {
+		return nil, err
+	}
+	if oidc != nil {
+		// The endpoints of the provider take precedence over the matchers.
+		rt.matchers = append(rt.matchers, oidc.matchers()...)
+	}
+
+	acme, err := validateACMEChallenge(c.ACME)
+	if err != nil {
+		return nil, err
+	}
+	if acme != nil {
+		rt.matchers = append(rt.matchers, acme.matcher())
+	}
+
 	for _, m := range c.Matchers {
-		if m.StatusCode == nil {
-			return nil, fmt.Errorf("must specify a status code in the matcher")
+		if m.GRPC != nil && m.GRPC.Method != nil && m.Path.isEmpty() {
+			// The gRPC method is the path of the request.
+			m.Path.Abs = m.GRPC.Method
 		}
-
 		p, err := validatePath(&m.Path)
 		if err != nil {
 			return nil, err
 		}
 
-		r, err := validateResponse(&m.Resp, "matcher")
+		sc, err := validateScenario(&m)
+		if err != nil {
+			return nil, err
+		}
+
+		st, err := validateStoreActions(m.Store)
+		if err != nil {
+			return nil, err
+		}
+
+		d, err := validateDelay(m.Delay, "matcher")
+		if err != nil {
+			return nil, err
+		}
+
+		b, err := validateBodyMatcher(m.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		g, err := validateGraphQLMatcher(m.GraphQL)
+		if err != nil {
+			return nil, err
+		}
+
+		j, err := validateJSONRPCMatcher(m.JSONRPC)
+		if err != nil {
+			return nil, err
+		}
+
+		gr, err := validateGRPCMatcher(m.GRPC)
+		if err != nil {
+			return nil, err
+		}
+
+		so, err := validateSOAPMatcher(m.SOAP)
+		if err != nil {
+			return nil, err
+		}
+
+		sip, err := validateSourceIPMatcher(m.SourceIP)
+		if err != nil {
+			return nil, err
+		}
+
+		sch, err := validateSchedule(&m)
+		if err != nil {
+			return nil, err
+		}
+
+		smp, err := validateSample(&m)
+		if err != nil {
+			return nil, err
+		}
+
+		rl, err := validateRateLimit(m.RateLimit, "matcher rate limit")
+		if err != nil {
+			return nil, err
+		}
+
+		ba, err := validateBasicAuth(m.BasicAuth)
+		if err != nil {
+			return nil, err
+		}
+
+		jw, err := validateJWTMatcher(m.JWT)
+		if err != nil {
+			return nil, err
+		}
+
+		hm, err := validateHMACSignature(m.HMAC)
 		if err != nil {
 			return nil, err
 		}
 
-		rt.matchers = append(rt.matchers, &matcherRuntime{
-			path:       p,
-			statusCode: *m.StatusCode,
-			resp:       r,
-		})
+		mrt := &matcherRuntime{
+			path:      p,
+			methods:   m.Methods,
+			body:      b,
+			graphQL:   g,
+			jsonRPC:   j,
+			grpc:      gr,
+			soap:      so,
+			sourceIP:  sip,
+			jwt:       jw,
+			schedule:  sch,
+			sample:    smp,
+			rateLimit: rl,
+			basicAuth: ba,
+			hmac:      hm,
+			scenario:  sc,
+			store:     st,
+			delay:     d,
+		}
+		if m.Sequence != nil {
+			if m.StatusCode != nil {
+				return nil, fmt.Errorf("cannot specify status code in the matcher when sequence is specified")
+			}
+			if !m.Resp.isEmpty() {
+				return nil, fmt.Errorf("cannot specify response in the matcher when sequence is specified")
+			}
+			if len(m.Responses) > 0 {
+				return nil, fmt.Errorf("cannot specify weighted responses in the matcher when sequence is specified")
+			}
+			seq, err := validateSequence(m.Sequence)
+			if err != nil {
+				return nil, err
+			}
+			mrt.sequence = seq
+		} else if len(m.Responses) > 0 {
+			if m.StatusCode != nil {
+				return nil, fmt.Errorf("cannot specify status code in the matcher when weighted responses are specified")
+			}
+			if !m.Resp.isEmpty() {
+				return nil, fmt.Errorf("cannot specify response in the matcher when weighted responses are specified")
+			}
+			for i := range m.Responses {
+				w, err := validateWeightedResponse(&m.Responses[i])
+				if err != nil {
+					return nil, err
+				}
+				mrt.weighted = append(mrt.weighted, w)
+				mrt.totalWeight += w.weight
+			}
+		} else {
+			if m.StatusCode == nil {
+				return nil, fmt.Errorf("must specify a status code in the matcher")
+			}
+			r, err := validateResponse(&m.Resp, "matcher", true)
+			if err != nil {
+				return nil, err
+			}
+			mrt.statusCode = *m.StatusCode
+			mrt.resp = r
+		}
+
+		err = validateJSONRPCResponses(mrt)
+		if err != nil {
+			return nil, err
+		}
+		if mrt.jsonRPC != nil {
+			rt.hasJSONRPC = true
+		}
+
+		rt.matchers = append(rt.matchers, mrt)
 	}
 
 	f, err := validateFallback(c.Fallback)
@@ -128,6 +382,54 @@ func (c *Config) validate() (*handlerRuntime, error) {
 	}
 	rt.fallback = f
 
+	if c.ScenarioResetPath != nil {
+		if *c.ScenarioResetPath == "" {
+			return nil, fmt.Errorf("scenario reset path cannot be empty")
+		}
+		rt.scenarioResetPath = c.ScenarioResetPath
+	}
+
+	cip, err := validateClientIP(c.ClientIP)
+	if err != nil {
+		return nil, err
+	}
+	rt.clientIP = cip
+
+	rl, err := validateRateLimit(c.RateLimit, "rate limit")
+	if err != nil {
+		return nil, err
+	}
+	if rl != nil && rl.key != nil && rl.key.mode == requestKeyModePathParam {
+		return nil, fmt.Errorf("cannot specify path param in rate limit key")
+	}
+	rt.rateLimit = rl
+
+	maint, err := validateMaintenance(c.Maintenance)
+	if err != nil {
+		return nil, err
+	}
+	rt.maintenance = maint
+
+	cors, err := validateCORS(c.CORS)
+	if err != nil {
+		return nil, err
+	}
+	rt.cors = cors
+
+	store, err := validateStoreConfig(c.Store)
+	if err != nil {
+		return nil, err
+	}
+	rt.store = store
+
+	rt.maxBodySize = defaultMaxBodySize
+	if c.MaxBodySize != nil {
+		if *c.MaxBodySize <= 0 {
+			return nil, fmt.Errorf("max body size must be positive")
+		}
+		rt.maxBodySize = *c.MaxBodySize
+	}
+
 	return rt, nil
 }
 
@@ -164,42 +466,149 @@ func validatePath(path *Path) (*pathRuntime, error) {
 	return p, nil
 }
 
-func validateResponse(resp *Response, loc string) (*responseRuntime, error) {
+// validateResponse validates the response at the specified location.
+// enveloped is true for the matcher responses, which can be wrapped in a
+// JSON-RPC envelope subject to validateJSONRPCResponses. Everywhere else,
+// a jsonrpc error response has no envelope to go in.
+func validateResponse(resp *Response, loc string, enveloped bool) (*responseRuntime, error) {
 	r := &responseRuntime{}
 
-	if resp.Raw != nil {
-		if resp.Template != nil {
-			return nil, fmt.Errorf("cannot specify template in %s response when raw is specified", loc)
-		}
-		if resp.JSON != nil {
-			return nil, fmt.Errorf("cannot specify json in %s response when raw is specified", loc)
-		}
+	body, err := responseBodyKind(resp, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	switch body {
+	case "raw":
 		r.mode = responseModeRaw
 		r.raw = *resp.Raw
-	} else if resp.Template != nil {
-		if resp.JSON != nil {
-			return nil, fmt.Errorf("cannot specify json in %s response when template is specified", loc)
-		}
-		templ, err := template.New("traefik-inline-response").Parse(*resp.Template)
+	case "template":
+		templ, err := parseHTMLTemplate(*resp.Template)
 		if err != nil {
 			return nil, fmt.Errorf("invalid template in %s response, reason: %w", loc, err)
 		}
 		r.mode = responseModeTemplate
 		r.templ = templ
-	} else if resp.JSON != nil {
+	case "json":
 		b, err := json.Marshal(*resp.JSON)
 		if err != nil {
 			return nil, fmt.Errorf("invalid JSON in %s response, reason: %w", loc, err)
 		}
 		r.mode = responseModeJSON
 		r.json = string(b)
-	} else {
+	case "sse":
+		sse, err := validateSSE(resp.SSE, loc)
+		if err != nil {
+			return nil, err
+		}
+		r.mode = responseModeSSE
+		r.sse = sse
+	case "websocket":
+		ws, err := validateWebSocket(resp.WebSocket, loc)
+		if err != nil {
+			return nil, err
+		}
+		r.mode = responseModeWebSocket
+		r.ws = ws
+	case "chunked":
+		chunked, err := validateChunked(resp.Chunked, loc)
+		if err != nil {
+			return nil, err
+		}
+		r.mode = responseModeChunked
+		r.chunked = chunked
+	case "jsonrpc error":
+		if !enveloped {
+			return nil, fmt.Errorf("cannot specify jsonrpc error in %s response, only matcher responses support it", loc)
+		}
+		b, err := validateJSONRPCError(resp.JSONRPCError, loc)
+		if err != nil {
+			return nil, err
+		}
+		r.mode = responseModeJSONRPCError
+		r.jsonRPCError = b
+	case "grpc":
+		g, err := validateGRPC(resp.GRPC, loc)
+		if err != nil {
+			return nil, err
+		}
+		r.mode = responseModeGRPC
+		r.grpc = g
+	case "soap":
+		so, err := validateSOAP(resp.SOAP, loc)
+		if err != nil {
+			return nil, err
+		}
+		r.mode = responseModeSOAP
+		r.soap = so
+	default:
 		r.mode = responseModeEmpty
 	}
 
+	if resp.Fault != nil && r.writesDirectly() {
+		return nil, fmt.Errorf("cannot specify fault in %s response when %s is specified", loc, body)
+	}
+	f, err := validateFault(resp.Fault, loc)
+	if err != nil {
+		return nil, err
+	}
+	r.fault = f
+
 	return r, nil
 }
 
+// responseBodyKind returns the name of the only kind of body specified in
+// the response, or an empty string if none are specified.
+func responseBodyKind(resp *Response, loc string) (string, error) {
+	kinds := []struct {
+		name      string
+		specified bool
+	}{
+		{"raw", resp.Raw != nil},
+		{"template", resp.Template != nil},
+		{"json", resp.JSON != nil},
+		{"sse", resp.SSE != nil},
+		{"websocket", resp.WebSocket != nil},
+		{"chunked", resp.Chunked != nil},
+		{"jsonrpc error", resp.JSONRPCError != nil},
+		{"grpc", resp.GRPC != nil},
+		{"soap", resp.SOAP != nil},
+	}
+
+	result := ""
+	for _, k := range kinds {
+		if !k.specified {
+			continue
+		}
+		if result != "" {
+			return "", fmt.Errorf("cannot specify %s in %s response when %s is specified", k.name, loc, result)
+		}
+		result = k.name
+	}
+	return result, nil
+}
+
+func validateWeightedResponse(weighted *WeightedResponse) (*weightedResponseRuntime, error) {
+	if weighted.Weight == nil || *weighted.Weight <= 0 {
+		return nil, fmt.Errorf("must specify a positive weight in the matcher weighted response")
+	}
+
+	if weighted.StatusCode == nil {
+		return nil, fmt.Errorf("must specify a status code in the matcher weighted response")
+	}
+
+	r, err := validateResponse(&weighted.Resp, "matcher weighted", true)
+	if err != nil {
+		return nil, err
+	}
+
+	return &weightedResponseRuntime{
+		weight:     *weighted.Weight,
+		statusCode: *weighted.StatusCode,
+		resp:       r,
+	}, nil
+}
+
 func validateFallback(fallback *Fallback) (*fallbackRuntime, error) {
 	if fallback == nil {
 		return nil, nil
@@ -209,7 +618,12 @@ func validateFallback(fallback *Fallback) (*fallbackRuntime, error) {
 		return nil, fmt.Errorf("must specify a status code in the fallback")
 	}
 
-	r, err := validateResponse(&fallback.Resp, "fallback")
+	r, err := validateResponse(&fallback.Resp, "fallback", false)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := validateDelay(fallback.Delay, "fallback")
 	if err != nil {
 		return nil, err
 	}
@@ -217,13 +631,35 @@ func validateFallback(fallback *Fallback) (*fallbackRuntime, error) {
 	return &fallbackRuntime{
 		statusCode: *fallback.StatusCode,
 		resp:       r,
+		delay:      d,
 	}, nil
 }
 
+func (p *Path) isEmpty() bool {
+	return p.Abs == nil && p.Prefix == nil && p.Regex == nil
+}
+
+func (r *Response) isEmpty() bool {
+	return r.Raw == nil && r.Template == nil && r.JSON == nil && r.SSE == nil && r.WebSocket == nil && r.Chunked == nil && r.JSONRPCError == nil && r.GRPC == nil && r.SOAP == nil && r.Fault == nil
+}
+
+// writesDirectly returns true if the response is written by its mode
+// directly to the client, instead of being rendered in full up front.
+func (r *responseRuntime) writesDirectly() bool {
+	switch r.mode {
+	case responseModeSSE, responseModeWebSocket, responseModeChunked, responseModeGRPC, responseModeSOAP, responseModeOIDC, responseModeACME:
+		return true
+	default:
+		return false
+	}
+}
+
 type Handler struct {
-	next    http.Handler
-	name    string
-	runtime *handlerRuntime
+	next      http.Handler
+	name      string
+	runtime   *handlerRuntime
+	random    *randomSource
+	scenarios *scenarioStore
 }
 
 func prettyPrintJSON(x interface{}) string {
@@ -247,68 +683,355 @@ func New(ctx context.Context, next http.Handler, config *Config, name string) (h
 	}
 
 	return &Handler{
-		next:    next,
-		name:    name,
-		runtime: rt,
+		next:      next,
+		name:      name,
+		runtime:   rt,
+		random:    newRandomSource(config.RandomSeed),
+		scenarios: newScenarioStore(),
 	}, nil
 }
 
 func (h *Handler) ServeHTTP(writer http.ResponseWriter, req *http.Request) {
-	for _, m := range h.runtime.matchers {
-		switch m.path.mode {
-		case pathMatcherModeAbsolutePath:
-			if req.URL.Path == *m.path.abs {
-				respondToRequest(req, writer, m.statusCode, m.resp)
-				return
-			}
-		case pathMatcherModePrefix:
-			if strings.HasPrefix(req.URL.Path, *m.path.prefix) {
-				respondToRequest(req, writer, m.statusCode, m.resp)
-				return
-			}
-		case pathMatcherModeRegex:
-			if m.path.regex.MatchString(req.URL.Path) {
-				respondToRequest(req, writer, m.statusCode, m.resp)
-				return
-			}
-		default:
-			respondWithError(writer, "invalid path matcher mode, indicating a bug in the plugin")
+	if h.runtime.scenarioResetPath != nil && req.URL.Path == *h.runtime.scenarioResetPath {
+		h.serveScenarioReset(writer, req)
+		return
+	}
+
+	if h.runtime.cors != nil && isCORSPreflight(req) {
+		h.runtime.cors.servePreflight(writer, req)
+		return
+	}
+
+	state := newRequestState(req, h.runtime)
+	if h.runtime.maintenance != nil {
+		if h.runtime.maintenance.bypass(state) {
+			h.next.ServeHTTP(writer, req)
+			return
+		}
+		h.runtime.cors.decorate(writer.Header(), req)
+		h.runtime.maintenance.respond(state, writer)
+		return
+	}
+
+	if rl := h.runtime.rateLimit; rl != nil && !rl.allow(state, writer) {
+		h.runtime.cors.decorate(writer.Header(), req)
+		h.respondToRequest(state, writer, rl.statusCode, rl.resp)
+		return
+	}
+
+	if h.mayMatchJSONRPC(req) && h.respondToJSONRPCBatch(state, writer) {
+		return
+	}
+
+	decorated := false
+	for {
+		m, err := h.findMatcher(state)
+		if err != nil {
+			respondWithError(writer, err.Error())
+			return
+		}
+		if m == nil {
+			break
+		}
+		if !decorated {
+			h.runtime.cors.decorate(writer.Header(), req)
+			decorated = true
+		}
+		if h.respondWithMatcher(state, writer, m) {
 			return
 		}
+		// A concurrent request moved the scenario of the matcher out of the
+		// required state, look for the matcher again in the new state.
 	}
 	if h.runtime.fallback != nil {
-		respondToRequest(req, writer, h.runtime.fallback.statusCode, h.runtime.fallback.resp)
+		if !decorated {
+			h.runtime.cors.decorate(writer.Header(), req)
+		}
+		if !h.injectDelay(req, h.runtime.fallback.delay) {
+			return
+		}
+		h.respondToRequest(state, writer, h.runtime.fallback.statusCode, h.runtime.fallback.resp)
 		return
 	}
 	h.next.ServeHTTP(writer, req)
 }
 
-func respondToRequest(req *http.Request, writer http.ResponseWriter, statusCode int, resp *responseRuntime) {
+// findMatcher returns the first matcher whose conditions are all satisfied
+// by the request, or nil if there are none. The path parameters of the
+// matcher are captured in the state for the conditions and the response.
+func (h *Handler) findMatcher(state *requestState) (*matcherRuntime, error) {
+	req := state.req
+	now := time.Now()
+	for _, m := range h.runtime.matchers {
+		if m.schedule != nil && !m.schedule.active(now) {
+			continue
+		}
+		matched, err := m.path.match(req.URL.Path)
+		if err != nil {
+			return nil, err
+		}
+		if !matched || !m.matchMethod(req.Method) {
+			continue
+		}
+		state.pathParams = m.path.params(req.URL.Path)
+		state.jwtClaims = nil
+		if m.sourceIP != nil && !m.sourceIP.match(state) {
+			continue
+		}
+		if m.jwt != nil && !m.jwt.match(state) {
+			continue
+		}
+		if m.body != nil && !m.body.match(state) {
+			continue
+		}
+		if m.graphQL != nil && !m.graphQL.match(state) {
+			continue
+		}
+		if m.jsonRPC != nil && !m.jsonRPC.match(state) {
+			continue
+		}
+		if m.grpc != nil && !m.grpc.match(req) {
+			continue
+		}
+		if m.soap != nil && !m.soap.match(state) {
+			continue
+		}
+		if m.sample != nil && !m.sample.sampled(state, h.random) {
+			continue
+		}
+		if m.scenario != nil && !h.scenarios.inState(m.scenario) {
+			continue
+		}
+		return m, nil
+	}
+	state.pathParams = nil
+	state.jwtClaims = nil
+	return nil, nil
+}
+
+// respondWithMatcher responds to the request with the matcher. It returns
+// false without responding if the scenario of the matcher is no longer in
+// the required state.
+func (h *Handler) respondWithMatcher(state *requestState, writer http.ResponseWriter, m *matcherRuntime) bool {
+	if !h.authorize(state, writer, m) {
+		return true
+	}
+	if m.rateLimit != nil && !m.rateLimit.allow(state, writer) {
+		h.respondToRequest(state, writer, m.rateLimit.statusCode, m.rateLimit.resp)
+		return true
+	}
+	updates, err := m.store.evaluate(state)
+	if err != nil {
+		respondWithError(writer, err.Error())
+		return true
+	}
+	if !h.advanceScenario(m) {
+		return false
+	}
+	statusCode, resp, ok := h.prepareResponse(state, m, updates)
+	if !ok {
+		return true
+	}
+	if m.jsonRPC != nil {
+		h.respondToJSONRPC(state, writer, statusCode, resp)
+		return true
+	}
+	h.respondToRequest(state, writer, statusCode, resp)
+	return true
+}
+
+// authorize checks the credentials and the signature of the request if
+// the matcher requires them, and sends the corresponding reject response
+// if they are missing or invalid. It returns false if the request has been
+// responded to.
+func (h *Handler) authorize(state *requestState, writer http.ResponseWriter, m *matcherRuntime) bool {
+	if m.basicAuth != nil && !m.basicAuth.authenticate(state) {
+		writer.Header().Set("WWW-Authenticate", m.basicAuth.challenge)
+		h.respondToRequest(state, writer, m.basicAuth.statusCode, m.basicAuth.resp)
+		return false
+	}
+	if m.hmac != nil && !m.hmac.verify(state, time.Now()) {
+		h.respondToRequest(state, writer, m.hmac.statusCode, m.hmac.resp)
+		return false
+	}
+	return true
+}
+
+// advanceScenario moves the scenario of the matcher to its new state, once
+// the request has been authorized and allowed by the rate limit, and the
+// store actions have been evaluated. It returns
+// false if a concurrent request has moved the scenario out of the required
+// state in the meantime, in which case the matcher must not respond.
+func (h *Handler) advanceScenario(m *matcherRuntime) bool {
+	if m.scenario == nil {
+		return true
+	}
+	return h.scenarios.transition(m.scenario)
+}
+
+// prepareResponse injects the delay and applies the evaluated store
+// actions of the matcher, before selecting the response. It returns false
+// if the client went away during the delay, in which case no response must
+// be written.
+func (h *Handler) prepareResponse(state *requestState, m *matcherRuntime, updates []storeUpdate) (int, *responseRuntime, bool) {
+	req := state.req
+	if !h.injectDelay(req, m.delay) {
+		return 0, nil, false
+	}
+	state.store.apply(updates)
+	statusCode, resp := h.selectResponse(m, state)
+	return statusCode, resp, true
+}
+
+// injectDelay waits for the configured delay (if any) before responding to
+// the request. It returns false if the client went away in the meantime,
+// in which case no response must be written.
+func (h *Handler) injectDelay(req *http.Request, delay *delayRuntime) bool {
+	if delay == nil {
+		return true
+	}
+	return sleep(req.Context(), delay.duration(h.random))
+}
+
+func (p *pathRuntime) match(path string) (bool, error) {
+	switch p.mode {
+	case pathMatcherModeAbsolutePath:
+		return path == *p.abs, nil
+	case pathMatcherModePrefix:
+		return strings.HasPrefix(path, *p.prefix), nil
+	case pathMatcherModeRegex:
+		return p.regex.MatchString(path), nil
+	default:
+		return false, fmt.Errorf("invalid path matcher mode, indicating a bug in the plugin")
+	}
+}
+
+// params returns the values of the named capture groups in the path regex.
+func (p *pathRuntime) params(path string) map[string]string {
+	if p.mode != pathMatcherModeRegex {
+		return nil
+	}
+
+	names := p.regex.SubexpNames()
+	matches := p.regex.FindStringSubmatch(path)
+	result := make(map[string]string)
+	for i, v := range matches {
+		if i > 0 && names[i] != "" {
+			result[names[i]] = v
+		}
+	}
+	return result
+}
+
+func (m *matcherRuntime) matchMethod(method string) bool {
+	if len(m.methods) == 0 {
+		return true
+	}
+	for _, mm := range m.methods {
+		if strings.EqualFold(mm, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// allResponses returns every response the matcher could respond with.
+func (m *matcherRuntime) allResponses() []*responseRuntime {
+	var result []*responseRuntime
+	if m.resp != nil {
+		result = append(result, m.resp)
+	}
+	for _, w := range m.weighted {
+		result = append(result, w.resp)
+	}
+	if m.sequence != nil {
+		for _, s := range m.sequence.responses {
+			result = append(result, s.resp)
+		}
+	}
+	return result
+}
+
+// selectResponse returns the status code and the response to use for a
+// request matching the specified matcher, picking the next response in
+// the sequence or one of the weighted responses at random if the matcher
+// has been configured with them.
+func (h *Handler) selectResponse(m *matcherRuntime, state *requestState) (int, *responseRuntime) {
+	if m.sequence != nil {
+		return m.sequence.next(state)
+	}
+	if len(m.weighted) == 0 {
+		return m.statusCode, m.resp
+	}
+
+	n := h.random.intn(m.totalWeight)
+	for _, w := range m.weighted {
+		if n < w.weight {
+			return w.statusCode, w.resp
+		}
+		n -= w.weight
+	}
+	// Unreachable since n is always less than the total weight.
+	last := m.weighted[len(m.weighted)-1]
+	return last.statusCode, last.resp
+}
+
+func (h *Handler) respondToRequest(state *requestState, writer http.ResponseWriter, statusCode int, resp *responseRuntime) {
 	var err error
+	switch resp.mode {
+	case responseModeSSE:
+		err = resp.sse.stream(state, writer, statusCode)
+	case responseModeWebSocket:
+		err = resp.ws.respond(writer, state.req, statusCode)
+	case responseModeChunked:
+		err = resp.chunked.stream(state.req, writer, statusCode)
+	case responseModeGRPC:
+		err = resp.grpc.respond(state.req, writer, statusCode)
+	case responseModeSOAP:
+		err = resp.soap.respond(state, writer, statusCode)
+	case responseModeOIDC:
+		resp.oidc.respond(state, writer)
+	case responseModeACME:
+		resp.acme.respond(state, writer)
+	default:
+		err = h.writeBody(state, writer, statusCode, resp)
+	}
 
+	if err != nil {
+		respondWithError(writer, fmt.Sprintf("failed while writing the response, reason: %s", err.Error()))
+	}
+}
+
+func (h *Handler) writeBody(state *requestState, writer http.ResponseWriter, statusCode int, resp *responseRuntime) error {
+	body, err := renderBody(state, resp)
+	if err != nil {
+		return err
+	}
+
+	if resp.fault != nil && resp.fault.triggered(h.random) {
+		return resp.fault.inject(state.req, writer, statusCode, body)
+	}
+
+	writer.WriteHeader(statusCode)
+	if len(body) > 0 {
+		_, err = writer.Write(body)
+	}
+	return err
+}
+
+func renderBody(state *requestState, resp *responseRuntime) ([]byte, error) {
 	switch resp.mode {
 	case responseModeEmpty:
-		writer.WriteHeader(statusCode)
+		return nil, nil
 	case responseModeRaw:
-		writer.WriteHeader(statusCode)
-		_, err = io.WriteString(writer, resp.raw)
+		return []byte(resp.raw), nil
 	case responseModeTemplate:
-		var buf bytes.Buffer
-		err = resp.templ.Execute(&buf, req)
-		if err == nil {
-			writer.WriteHeader(statusCode)
-			_, err = io.Copy(writer, &buf)
-		}
+		return executeHTMLTemplate(resp.templ, state)
 	case responseModeJSON:
-		writer.WriteHeader(statusCode)
 		// TODO: Set the content type header.
-		_, err = io.WriteString(writer, resp.json)
+		return []byte(resp.json), nil
 	default:
-		err = fmt.Errorf("invalid path matcher mode, indicating a bug in the plugin")
-	}
-
-	if err != nil {
-		respondWithError(writer, fmt.Sprintf("failed while writing the response, reason: %s", err.Error()))
+		return nil, fmt.Errorf("invalid response mode, indicating a bug in the plugin")
 	}
 }
 
@@ -0,0 +1,327 @@
+package traefik_inline_response
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// JSONRPCMatcher is a set of conditions on the JSON-RPC 2.0 call in the
+// request body, all of which must be satisfied for the matcher to match
+// the request.
+type JSONRPCMatcher struct {
+	Method *string         `json:"method" mapstructure:"method"`
+	Params []JSONPredicate `json:"params" mapstructure:"params"`
+}
+
+// JSONRPCError is the error object returned in the JSON-RPC response
+// envelope.
+type JSONRPCError struct {
+	Code    *int    `json:"code" mapstructure:"code"`
+	Message *string `json:"message" mapstructure:"message"`
+	Data    any     `json:"data" mapstructure:"data"`
+}
+
+const jsonRPCVersion = "2.0"
+
+const (
+	jsonRPCErrorInvalidRequest = -32600
+	jsonRPCErrorMethodNotFound = -32601
+)
+
+type jsonRPCMatcherRuntime struct {
+	method *string
+	params []*jsonPredicateRuntime
+}
+
+// jsonRPCCall is a single JSON-RPC 2.0 call parsed from the request, which
+// is also made available to the templates.
+type jsonRPCCall struct {
+	Method string
+	Params any
+	ID     any
+	rawID  json.RawMessage
+}
+
+type jsonRPCRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  *string         `json:"method"`
+	Params  any             `json:"params"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type jsonRPCResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   json.RawMessage `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type jsonRPCErrorObject struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+func validateJSONRPCMatcher(rpc *JSONRPCMatcher) (*jsonRPCMatcherRuntime, error) {
+	if rpc == nil {
+		return nil, nil
+	}
+
+	if rpc.Method == nil {
+		return nil, fmt.Errorf("must specify a method in matcher jsonrpc")
+	}
+	p, err := validateJSONPredicates(rpc.Params, "matcher jsonrpc params")
+	if err != nil {
+		return nil, err
+	}
+
+	return &jsonRPCMatcherRuntime{
+		method: rpc.Method,
+		params: p,
+	}, nil
+}
+
+func validateJSONRPCError(rpcErr *JSONRPCError, loc string) ([]byte, error) {
+	if rpcErr.Code == nil {
+		return nil, fmt.Errorf("must specify a code in %s response jsonrpc error", loc)
+	}
+	if rpcErr.Message == nil {
+		return nil, fmt.Errorf("must specify a message in %s response jsonrpc error", loc)
+	}
+
+	b, err := json.Marshal(&jsonRPCErrorObject{
+		Code:    *rpcErr.Code,
+		Message: *rpcErr.Message,
+		Data:    rpcErr.Data,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid data in %s response jsonrpc error, reason: %w", loc, err)
+	}
+	return b, nil
+}
+
+// validateJSONRPCResponses verifies that the responses of a matcher can be
+// wrapped in a JSON-RPC envelope if and only if the matcher has a jsonrpc
+// condition.
+func validateJSONRPCResponses(m *matcherRuntime) error {
+	for _, r := range m.allResponses() {
+		if m.jsonRPC == nil {
+			if r.mode == responseModeJSONRPCError {
+				return fmt.Errorf("cannot specify jsonrpc error in the matcher response without a jsonrpc condition")
+			}
+			continue
+		}
+		switch r.mode {
+		case responseModeEmpty, responseModeJSON, responseModeJSONRPCError:
+		default:
+			return fmt.Errorf("matcher response can only specify json or jsonrpc error when jsonrpc condition is specified")
+		}
+		if r.fault != nil {
+			return fmt.Errorf("cannot specify fault in the matcher response when jsonrpc condition is specified")
+		}
+	}
+	return nil
+}
+
+func (j *jsonRPCMatcherRuntime) match(state *requestState) bool {
+	call := state.jsonRPC()
+	if call == nil || call.Method != *j.method {
+		return false
+	}
+	if len(j.params) > 0 {
+		params := call.Params
+		if params == nil {
+			params = map[string]any{}
+		}
+		if !matchJSONPredicates(j.params, params) {
+			return false
+		}
+	}
+	return true
+}
+
+func parseJSONRPCCall(raw []byte) *jsonRPCCall {
+	var r jsonRPCRequest
+	if json.Unmarshal(raw, &r) != nil || r.JSONRPC != jsonRPCVersion || r.Method == nil {
+		return nil
+	}
+
+	call := &jsonRPCCall{
+		Method: *r.Method,
+		Params: r.Params,
+		rawID:  r.ID,
+	}
+	if r.ID != nil {
+		//nolint:errcheck
+		json.Unmarshal(r.ID, &call.ID)
+	}
+	return call
+}
+
+func (c *jsonRPCCall) isNotification() bool {
+	return c.rawID == nil
+}
+
+// envelope wraps the response in a JSON-RPC response object. The JSON
+// response is used as the result, and an empty response as a null result.
+func (c *jsonRPCCall) envelope(resp *responseRuntime) *jsonRPCResponse {
+	r := &jsonRPCResponse{
+		JSONRPC: jsonRPCVersion,
+		ID:      c.rawID,
+	}
+	switch resp.mode {
+	case responseModeJSON:
+		r.Result = json.RawMessage(resp.json)
+	case responseModeJSONRPCError:
+		r.Error = resp.jsonRPCError
+	default:
+		r.Result = json.RawMessage("null")
+	}
+	return r
+}
+
+func jsonRPCErrorResponse(id json.RawMessage, code int, message string) *jsonRPCResponse {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	b, _ := json.Marshal(&jsonRPCErrorObject{Code: code, Message: message})
+	return &jsonRPCResponse{
+		JSONRPC: jsonRPCVersion,
+		Error:   b,
+		ID:      id,
+	}
+}
+
+func (h *Handler) respondToJSONRPC(state *requestState, writer http.ResponseWriter, statusCode int, resp *responseRuntime) {
+	call := state.jsonRPC()
+	if call.isNotification() {
+		writer.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(writer, statusCode, call.envelope(resp))
+}
+
+// mayMatchJSONRPC returns true if the path and the method of the request
+// match a matcher with a jsonrpc condition, so that the body of the other
+// requests is not read in search of a batch.
+func (h *Handler) mayMatchJSONRPC(req *http.Request) bool {
+	if !h.runtime.hasJSONRPC {
+		return false
+	}
+	for _, m := range h.runtime.matchers {
+		if m.jsonRPC == nil || !m.matchMethod(req.Method) {
+			continue
+		}
+		if matched, err := m.path.match(req.URL.Path); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// respondToJSONRPCBatch responds to a batch of JSON-RPC calls with an array
+// of the responses, if at least one of the calls matches a matcher. It
+// returns false without writing anything otherwise. The batch is always
+// responded to with a 200, since the status codes of the matchers apply to
+// the individual calls which have no status of their own.
+func (h *Handler) respondToJSONRPCBatch(state *requestState, writer http.ResponseWriter) bool {
+	body, err := state.readBody()
+	if err != nil {
+		return false
+	}
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 || body[0] != '[' {
+		return false
+	}
+	var raws []json.RawMessage
+	if json.Unmarshal(body, &raws) != nil {
+		return false
+	}
+
+	matched := false
+	results := make([]*jsonRPCResponse, 0, len(raws))
+	for _, raw := range raws {
+		call := parseJSONRPCCall(raw)
+		if call == nil {
+			results = append(results, jsonRPCErrorResponse(nil, jsonRPCErrorInvalidRequest, "Invalid Request"))
+			continue
+		}
+
+		callState := state.forJSONRPCCall(call)
+		var m *matcherRuntime
+		var updates []storeUpdate
+		for {
+			var err error
+			m, err = h.findMatcher(callState)
+			if err != nil {
+				respondWithError(writer, err.Error())
+				return true
+			}
+			if m == nil || m.jsonRPC == nil {
+				break
+			}
+
+			if !matched {
+				// Decorate before any of the calls can be rejected, since the
+				// batch is responded to from here on.
+				h.runtime.cors.decorate(writer.Header(), state.req)
+				matched = true
+			}
+			if !h.authorize(callState, writer, m) {
+				return true
+			}
+			if m.rateLimit != nil && !m.rateLimit.allow(callState, writer) {
+				// Like the authorization, the whole batch is rejected.
+				h.respondToRequest(callState, writer, m.rateLimit.statusCode, m.rateLimit.resp)
+				return true
+			}
+			updates, err = m.store.evaluate(callState)
+			if err != nil {
+				respondWithError(writer, err.Error())
+				return true
+			}
+			if h.advanceScenario(m) {
+				break
+			}
+			// Look for the matcher again, like for the single requests.
+		}
+		if m == nil || m.jsonRPC == nil {
+			if !call.isNotification() {
+				results = append(results, jsonRPCErrorResponse(call.rawID, jsonRPCErrorMethodNotFound, "Method not found"))
+			}
+			continue
+		}
+
+		_, resp, ok := h.prepareResponse(callState, m, updates)
+		if !ok {
+			return true
+		}
+		if !call.isNotification() {
+			results = append(results, call.envelope(resp))
+		}
+	}
+
+	if !matched {
+		return false
+	}
+	if len(results) == 0 {
+		writer.WriteHeader(http.StatusNoContent)
+		return true
+	}
+	writeJSON(writer, http.StatusOK, results)
+	return true
+}
+
+func writeJSON(writer http.ResponseWriter, statusCode int, v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		respondWithError(writer, fmt.Sprintf("failed while writing the response, reason: %s", err.Error()))
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(statusCode)
+	//nolint:errcheck
+	writer.Write(b)
+}
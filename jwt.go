@@ -0,0 +1,539 @@
+package traefik_inline_response
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+// JWTMatcher is a condition on the bearer token of the request, which must
+// be a JWT with a valid signature, within its validity period, issued by
+// the issuer for the audience (when specified), and whose claims satisfy
+// all the predicates.
+type JWTMatcher struct {
+	Secret     *string         `json:"secret" mapstructure:"secret"`
+	PublicKeys []string        `json:"publicKeys" mapstructure:"publicKeys"`
+	JWKSFile   *string         `json:"jwksFile" mapstructure:"jwksFile"`
+	Issuer     *string         `json:"issuer" mapstructure:"issuer"`
+	Audience   *string         `json:"audience" mapstructure:"audience"`
+	Leeway     *string         `json:"leeway" mapstructure:"leeway"`
+	Claims     []JSONPredicate `json:"claims" mapstructure:"claims"`
+}
+
+const (
+	jwtAlgHS256 = "HS256"
+	jwtAlgRS256 = "RS256"
+	jwtAlgES256 = "ES256"
+)
+
+type jwtMatcherRuntime struct {
+	keys     []*jwtKey
+	issuer   *string
+	audience *string
+	leeway   time.Duration
+	claims   []*jsonPredicateRuntime
+}
+
+// jwtKey is a key for verifying the signature of the tokens, with exactly
+// one of the secret, the RSA or the ECDSA public key set.
+type jwtKey struct {
+	kid    string
+	secret []byte
+	rsa    *rsa.PublicKey
+	ecdsa  *ecdsa.PublicKey
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// jwk is a JSON Web Key (RFC 7517) with the parameters of the supported key
+// types.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+type jwks struct {
+	Keys []jwk `json:"keys"`
+}
+
+func validateJWTMatcher(j *JWTMatcher) (*jwtMatcherRuntime, error) {
+	if j == nil {
+		return nil, nil
+	}
+
+	if j.Secret == nil && len(j.PublicKeys) == 0 && j.JWKSFile == nil {
+		return nil, fmt.Errorf("at least one of secret, public keys or jwks file must be specified in matcher jwt")
+	}
+	r := &jwtMatcherRuntime{
+		issuer:   j.Issuer,
+		audience: j.Audience,
+	}
+	if j.Secret != nil {
+		if *j.Secret == "" {
+			return nil, fmt.Errorf("secret cannot be empty in matcher jwt")
+		}
+		r.keys = append(r.keys, &jwtKey{secret: []byte(*j.Secret)})
+	}
+	for _, p := range j.PublicKeys {
+		k, err := parsePublicKeyPEM(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key in matcher jwt, reason: %w", err)
+		}
+		r.keys = append(r.keys, k)
+	}
+	if j.JWKSFile != nil {
+		keys, err := readJWKSFile(*j.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		r.keys = append(r.keys, keys...)
+	}
+
+	if j.Leeway != nil {
+		d, err := time.ParseDuration(*j.Leeway)
+		if err != nil {
+			return nil, fmt.Errorf("invalid leeway in matcher jwt, reason: %w", err)
+		}
+		if d < 0 {
+			return nil, fmt.Errorf("leeway in matcher jwt cannot be negative")
+		}
+		r.leeway = d
+	}
+
+	c, err := validateJSONPredicates(j.Claims, "matcher jwt claims")
+	if err != nil {
+		return nil, err
+	}
+	r.claims = c
+
+	return r, nil
+}
+
+// parsePublicKeyPEM parses an RSA or a P-256 ECDSA public key from a PEM
+// encoded public key or certificate.
+func parsePublicKeyPEM(text string) (*jwtKey, error) {
+	block, _ := pem.Decode([]byte(text))
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+
+	var pub any
+	var err error
+	switch block.Type {
+	case "PUBLIC KEY":
+		pub, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		pub, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+		cert, err = x509.ParseCertificate(block.Bytes)
+		if err == nil {
+			pub = cert.PublicKey
+		}
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		return &jwtKey{rsa: k}, nil
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("unsupported elliptic curve, must be P-256")
+		}
+		return &jwtKey{ecdsa: k}, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", pub)
+	}
+}
+
+func readJWKSFile(path string) ([]*jwtKey, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the jwks file in matcher jwt, reason: %w", err)
+	}
+	var set jwks
+	err = json.Unmarshal(b, &set)
+	if err != nil {
+		return nil, fmt.Errorf("invalid jwks file in matcher jwt, reason: %w", err)
+	}
+
+	var keys []*jwtKey
+	for i := range set.Keys {
+		k, err := set.Keys[i].key()
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %d in the jwks file in matcher jwt, reason: %w", i, err)
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+func (k *jwk) key() (*jwtKey, error) {
+	switch k.Kty {
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil || len(secret) == 0 {
+			return nil, fmt.Errorf("invalid k")
+		}
+		return &jwtKey{kid: k.Kid, secret: secret}, nil
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid n")
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil || !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid e")
+		}
+		return &jwtKey{kid: k.Kid, rsa: &rsa.PublicKey{N: n, E: int(e.Int64())}}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q, must be P-256", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x")
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y")
+		}
+		//nolint:staticcheck
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point is not on the curve")
+		}
+		return &jwtKey{kid: k.Kid, ecdsa: &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, fmt.Errorf("invalid base64url encoded integer")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// bearerToken returns the bearer token in the Authorization header, or an
+// empty string if there is none.
+func bearerToken(state *requestState) string {
+	auth := state.req.Header.Get("Authorization")
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(auth[7:])
+}
+
+// match returns true if the bearer token is valid and satisfies all the
+// conditions, in which case the claims are recorded in the state.
+func (j *jwtMatcherRuntime) match(state *requestState) bool {
+	claims, ok := j.verify(bearerToken(state))
+	if !ok || !j.validClaims(claims, time.Now()) || !matchJSONPredicates(j.claims, claims) {
+		return false
+	}
+	state.jwtClaims = claims
+	return true
+}
+
+// verify verifies the signature of the token, returning the decoded
+// claims.
+func (j *jwtMatcherRuntime) verify(token string) (map[string]any, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, false
+	}
+	hb, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, false
+	}
+	var header jwtHeader
+	if json.Unmarshal(hb, &header) != nil {
+		return nil, false
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, false
+	}
+
+	signed := []byte(token[:len(parts[0])+1+len(parts[1])])
+	verified := false
+	for _, k := range j.keys {
+		if header.Kid != "" && k.kid != "" && header.Kid != k.kid {
+			continue
+		}
+		if k.verify(header.Alg, signed, sig) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, false
+	}
+
+	pb, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, false
+	}
+	var claims map[string]any
+	if json.Unmarshal(pb, &claims) != nil || claims == nil {
+		return nil, false
+	}
+	return claims, true
+}
+
+// verify returns true if the signature of the signed data is valid for the
+// algorithm, which must match the type of the key.
+func (k *jwtKey) verify(alg string, signed, sig []byte) bool {
+	digest := sha256.Sum256(signed)
+	switch {
+	case alg == jwtAlgHS256 && k.secret != nil:
+		mac := hmac.New(sha256.New, k.secret)
+		//nolint:errcheck
+		mac.Write(signed)
+		return hmac.Equal(sig, mac.Sum(nil))
+	case alg == jwtAlgRS256 && k.rsa != nil:
+		return rsa.VerifyPKCS1v15(k.rsa, crypto.SHA256, digest[:], sig) == nil
+	case alg == jwtAlgES256 && k.ecdsa != nil:
+		if len(sig) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		return ecdsa.Verify(k.ecdsa, digest[:], r, s)
+	default:
+		return false
+	}
+}
+
+// validClaims checks the registered exp, nbf, iss and aud claims.
+func (j *jwtMatcherRuntime) validClaims(claims map[string]any, now time.Time) bool {
+	if v, ok := claims["exp"]; ok {
+		exp, ok := v.(float64)
+		if !ok || !now.Before(unixTime(exp).Add(j.leeway)) {
+			return false
+		}
+	}
+	if v, ok := claims["nbf"]; ok {
+		nbf, ok := v.(float64)
+		if !ok || now.Add(j.leeway).Before(unixTime(nbf)) {
+			return false
+		}
+	}
+	if j.issuer != nil {
+		if iss, _ := claims["iss"].(string); iss != *j.issuer {
+			return false
+		}
+	}
+	if j.audience != nil && !hasAudience(claims["aud"], *j.audience) {
+		return false
+	}
+	return true
+}
+
+// maxClaimSeconds bounds the numeric dates of the claims to about 31
+// million years either side of the epoch, well within the range of
+// time.Time and of the arithmetic done on it.
+const maxClaimSeconds = 1e15
+
+// unixTime converts the numeric date of a claim to a time, without going
+// through a time.Duration which overflows for dates beyond the year 2262.
+// Dates beyond the bounds are clamped, so that they never wrap around to
+// the other side of the epoch.
+func unixTime(secs float64) time.Time {
+	if secs > maxClaimSeconds {
+		secs = maxClaimSeconds
+	} else if secs < -maxClaimSeconds {
+		secs = -maxClaimSeconds
+	}
+	whole := math.Floor(secs)
+	return time.Unix(int64(whole), int64((secs-whole)*1e9))
+}
+
+// hasAudience returns true if the aud claim, which is either a string or
+// an array of strings, contains the audience.
+func hasAudience(aud any, audience string) bool {
+	switch a := aud.(type) {
+	case string:
+		return a == audience
+	case []any:
+		for _, v := range a {
+			if s, ok := v.(string); ok && s == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// jwtSigner signs the tokens with an RSA (RS256) or a P-256 ECDSA (ES256)
+// private key.
+type jwtSigner struct {
+	alg string
+	kid string
+	key crypto.Signer
+	jwk map[string]any
+}
+
+// parsePrivateKeyPEM parses an RSA or a P-256 ECDSA private key from a PEM
+// encoded PKCS #8, PKCS #1 or SEC 1 private key.
+func parsePrivateKeyPEM(text string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(text))
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+
+	var key any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return k, nil
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("unsupported elliptic curve, must be P-256")
+		}
+		return k, nil
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+}
+
+// newJWTSigner returns a signer for the key. The key ID defaults to the
+// JWK thumbprint (RFC 7638) of the public key.
+func newJWTSigner(key crypto.Signer, kid string) (*jwtSigner, error) {
+	s := &jwtSigner{key: key}
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		s.alg = jwtAlgRS256
+		s.jwk = map[string]any{
+			"kty": "RSA",
+			"n":   base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+		}
+	case *ecdsa.PrivateKey:
+		x := make([]byte, 32)
+		y := make([]byte, 32)
+		k.X.FillBytes(x)
+		k.Y.FillBytes(y)
+		s.alg = jwtAlgES256
+		s.jwk = map[string]any{
+			"kty": "EC",
+			"crv": "P-256",
+			"x":   base64.RawURLEncoding.EncodeToString(x),
+			"y":   base64.RawURLEncoding.EncodeToString(y),
+		}
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+
+	if kid == "" {
+		// The required members of the JWK are encoded with the keys sorted
+		// and without any whitespace.
+		b, err := json.Marshal(s.jwk)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(b)
+		kid = base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+	s.kid = kid
+	return s, nil
+}
+
+// publicJWK returns the public key as a JWK for verifying the signatures.
+func (s *jwtSigner) publicJWK() map[string]any {
+	k := map[string]any{
+		"kid": s.kid,
+		"alg": s.alg,
+		"use": "sig",
+	}
+	for n, v := range s.jwk {
+		k[n] = v
+	}
+	return k
+}
+
+// verificationKey returns the public key for verifying the signatures.
+func (s *jwtSigner) verificationKey() *jwtKey {
+	k := &jwtKey{kid: s.kid}
+	switch pub := s.key.Public().(type) {
+	case *rsa.PublicKey:
+		k.rsa = pub
+	case *ecdsa.PublicKey:
+		k.ecdsa = pub
+	}
+	return k
+}
+
+func (s *jwtSigner) sign(claims map[string]any) (string, error) {
+	hb, err := json.Marshal(map[string]any{"alg": s.alg, "kid": s.kid, "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	cb, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := base64.RawURLEncoding.EncodeToString(hb) + "." + base64.RawURLEncoding.EncodeToString(cb)
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	switch k := s.key.(type) {
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		if err != nil {
+			return "", err
+		}
+	case *ecdsa.PrivateKey:
+		r, ss, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			return "", err
+		}
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		ss.FillBytes(sig[32:])
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
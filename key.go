@@ -0,0 +1,94 @@
+package traefik_inline_response
+
+import "fmt"
+
+// RequestKey identifies the part of the request which is used to derive a
+// key for tracking per client state.
+type RequestKey struct {
+	Header    *string `json:"header" mapstructure:"header"`
+	Query     *string `json:"query" mapstructure:"query"`
+	Cookie    *string `json:"cookie" mapstructure:"cookie"`
+	PathParam *string `json:"pathParam" mapstructure:"pathParam"`
+	ClientIP  bool    `json:"clientIP" mapstructure:"clientIP"`
+}
+
+const (
+	requestKeyModeUnknown = iota
+	requestKeyModeHeader
+	requestKeyModeQuery
+	requestKeyModeCookie
+	requestKeyModePathParam
+	requestKeyModeClientIP
+)
+
+type requestKeyMode uint8
+
+type requestKeyRuntime struct {
+	mode requestKeyMode
+	name string
+}
+
+func validateRequestKey(key *RequestKey, loc string) (*requestKeyRuntime, error) {
+	if key == nil {
+		return nil, nil
+	}
+
+	kinds := []struct {
+		name      string
+		specified bool
+		mode      requestKeyMode
+		value     *string
+	}{
+		{"header", key.Header != nil, requestKeyModeHeader, key.Header},
+		{"query", key.Query != nil, requestKeyModeQuery, key.Query},
+		{"cookie", key.Cookie != nil, requestKeyModeCookie, key.Cookie},
+		{"path param", key.PathParam != nil, requestKeyModePathParam, key.PathParam},
+		{"client IP", key.ClientIP, requestKeyModeClientIP, nil},
+	}
+
+	k := &requestKeyRuntime{}
+	result := ""
+	for _, kind := range kinds {
+		if !kind.specified {
+			continue
+		}
+		if result != "" {
+			return nil, fmt.Errorf("cannot specify %s in %s key when %s is specified", kind.name, loc, result)
+		}
+		result = kind.name
+		k.mode = kind.mode
+		if kind.value != nil {
+			k.name = *kind.value
+		}
+	}
+	if result == "" {
+		return nil, fmt.Errorf("at least one of header, query, cookie, path param or client IP must be specified in %s key", loc)
+	}
+
+	return k, nil
+}
+
+// value returns the key derived from the request. Requests lacking the
+// configured header, query parameter, cookie or path parameter all share
+// the empty key.
+func (k *requestKeyRuntime) value(state *requestState) string {
+	req := state.req
+	switch k.mode {
+	case requestKeyModeHeader:
+		return req.Header.Get(k.name)
+	case requestKeyModeQuery:
+		return req.URL.Query().Get(k.name)
+	case requestKeyModeCookie:
+		c, err := req.Cookie(k.name)
+		if err != nil {
+			return ""
+		}
+		return c.Value
+	case requestKeyModePathParam:
+		return state.pathParams[k.name]
+	case requestKeyModeClientIP:
+		return state.clientIP()
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,227 @@
+package traefik_inline_response
+
+import (
+	"crypto/subtle"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Maintenance is the configuration for responding to all the requests with
+// a 503 maintenance response, except for the ones satisfying any of the
+// bypass conditions which are passed on to the next handler.
+type Maintenance struct {
+	RetryAfter *string            `json:"retryAfter" mapstructure:"retryAfter"`
+	HTML       *string            `json:"html" mapstructure:"html"`
+	JSON       *string            `json:"json" mapstructure:"json"`
+	Bypass     *MaintenanceBypass `json:"bypass" mapstructure:"bypass"`
+}
+
+// MaintenanceBypass is the set of conditions, any of which lets the request
+// bypass the maintenance response.
+type MaintenanceBypass struct {
+	Cookie   *BypassSecret `json:"cookie" mapstructure:"cookie"`
+	Header   *BypassSecret `json:"header" mapstructure:"header"`
+	SourceIP []string      `json:"sourceIP" mapstructure:"sourceIP"`
+}
+
+// BypassSecret is a cookie or a header which must carry the secret value
+// to bypass the maintenance response.
+type BypassSecret struct {
+	Name  *string `json:"name" mapstructure:"name"`
+	Value *string `json:"value" mapstructure:"value"`
+}
+
+const (
+	defaultMaintenanceRetryAfter = 5 * time.Minute
+	defaultMaintenanceHTML       = `<!DOCTYPE html>
+<html>
+<head><title>Down for maintenance</title></head>
+<body>
+<h1>Down for maintenance</h1>
+<p>We are performing scheduled maintenance and will be back shortly.</p>
+</body>
+</html>
+`
+	defaultMaintenanceJSON = `{"error":"service unavailable","message":"down for maintenance"}`
+)
+
+type maintenanceRuntime struct {
+	retryAfter string
+	html       *htmltemplate.Template
+	json       *template.Template
+	cookie     *bypassSecretRuntime
+	header     *bypassSecretRuntime
+	sourceIP   []*net.IPNet
+}
+
+type bypassSecretRuntime struct {
+	name  string
+	value []byte
+}
+
+func validateMaintenance(maint *Maintenance) (*maintenanceRuntime, error) {
+	if maint == nil {
+		return nil, nil
+	}
+
+	m := &maintenanceRuntime{
+		retryAfter: strconv.Itoa(int(defaultMaintenanceRetryAfter.Seconds())),
+	}
+	if maint.RetryAfter != nil {
+		d, err := time.ParseDuration(*maint.RetryAfter)
+		if err != nil {
+			return nil, fmt.Errorf("invalid retry after in maintenance, reason: %w", err)
+		}
+		if d < time.Second {
+			return nil, fmt.Errorf("retry after in maintenance must be at least a second")
+		}
+		m.retryAfter = strconv.Itoa(int(d.Seconds()))
+	}
+
+	htmlText := defaultMaintenanceHTML
+	if maint.HTML != nil {
+		htmlText = *maint.HTML
+	}
+	ht, err := parseHTMLTemplate(htmlText)
+	if err != nil {
+		return nil, fmt.Errorf("invalid html template in maintenance, reason: %w", err)
+	}
+	m.html = ht
+
+	jsonText := defaultMaintenanceJSON
+	if maint.JSON != nil {
+		jsonText = *maint.JSON
+	}
+	jt, err := parseTextTemplate(jsonText)
+	if err != nil {
+		return nil, fmt.Errorf("invalid json template in maintenance, reason: %w", err)
+	}
+	m.json = jt
+
+	if maint.Bypass != nil {
+		b := maint.Bypass
+		if b.Cookie == nil && b.Header == nil && len(b.SourceIP) == 0 {
+			return nil, fmt.Errorf("at least one of cookie, header or source IP must be specified in maintenance bypass")
+		}
+		m.cookie, err = validateBypassSecret(b.Cookie, "cookie")
+		if err != nil {
+			return nil, err
+		}
+		m.header, err = validateBypassSecret(b.Header, "header")
+		if err != nil {
+			return nil, err
+		}
+		m.sourceIP, err = parseCIDRs(b.SourceIP, "maintenance bypass source IP")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+func validateBypassSecret(secret *BypassSecret, kind string) (*bypassSecretRuntime, error) {
+	if secret == nil {
+		return nil, nil
+	}
+
+	if secret.Name == nil || *secret.Name == "" {
+		return nil, fmt.Errorf("must specify a name in maintenance bypass %s", kind)
+	}
+	if secret.Value == nil || *secret.Value == "" {
+		return nil, fmt.Errorf("must specify a value in maintenance bypass %s", kind)
+	}
+	return &bypassSecretRuntime{
+		name:  *secret.Name,
+		value: []byte(*secret.Value),
+	}, nil
+}
+
+func (b *bypassSecretRuntime) match(value string) bool {
+	return subtle.ConstantTimeCompare([]byte(value), b.value) == 1
+}
+
+// bypass returns true if the request satisfies any of the bypass
+// conditions.
+func (m *maintenanceRuntime) bypass(state *requestState) bool {
+	if m.cookie != nil {
+		if c, err := state.req.Cookie(m.cookie.name); err == nil && m.cookie.match(c.Value) {
+			return true
+		}
+	}
+	if m.header != nil {
+		if v := state.req.Header.Get(m.header.name); v != "" && m.header.match(v) {
+			return true
+		}
+	}
+	if len(m.sourceIP) > 0 {
+		if ip := net.ParseIP(state.clientIP()); ip != nil && containsIP(m.sourceIP, ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *maintenanceRuntime) respond(state *requestState, writer http.ResponseWriter) {
+	var body []byte
+	var contentType string
+	var err error
+	if prefersJSON(state.req.Header.Get("Accept")) {
+		var s string
+		s, err = executeTextTemplate(m.json, state)
+		body, contentType = []byte(s), "application/json"
+	} else {
+		body, err = executeHTMLTemplate(m.html, state)
+		contentType = "text/html; charset=utf-8"
+	}
+	if err != nil {
+		respondWithError(writer, fmt.Sprintf("failed while rendering the maintenance response, reason: %s", err.Error()))
+		return
+	}
+
+	header := writer.Header()
+	header.Set("Content-Type", contentType)
+	header.Set("Retry-After", m.retryAfter)
+	header.Set("Cache-Control", "no-store")
+	header.Add("Vary", "Accept")
+	writer.WriteHeader(http.StatusServiceUnavailable)
+	//nolint:errcheck
+	writer.Write(body)
+}
+
+// prefersJSON returns true if the Accept header prefers JSON over HTML.
+// HTML wins the ties, and is also used when the header is absent.
+func prefersJSON(accept string) bool {
+	htmlQ, jsonQ := -1.0, -1.0
+	for _, r := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(r))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+		}
+		switch {
+		case mt == "application/json" || strings.HasSuffix(mt, "+json"):
+			if q > jsonQ {
+				jsonQ = q
+			}
+		case mt == "text/html":
+			if q > htmlQ {
+				htmlQ = q
+			}
+		}
+	}
+	return jsonQ > 0 && jsonQ > htmlQ
+}
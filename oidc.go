@@ -0,0 +1,354 @@
+package traefik_inline_response
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// OIDCProvider is the configuration for a mock OAuth2 / OpenID Connect
+// provider, whose endpoints are served under the path of the issuer.
+type OIDCProvider struct {
+	Issuer       *string        `json:"issuer" mapstructure:"issuer"`
+	SigningKey   *string        `json:"signingKey" mapstructure:"signingKey"`
+	KeyID        *string        `json:"keyID" mapstructure:"keyID"`
+	ClientID     *string        `json:"clientID" mapstructure:"clientID"`
+	ClientSecret *string        `json:"clientSecret" mapstructure:"clientSecret"`
+	Audience     *string        `json:"audience" mapstructure:"audience"`
+	TokenTTL     *string        `json:"tokenTTL" mapstructure:"tokenTTL"`
+	Claims       map[string]any `json:"claims" mapstructure:"claims"`
+}
+
+const (
+	oidcDiscoveryPath = "/.well-known/openid-configuration"
+	oidcJWKSPath      = "/jwks"
+	oidcTokenPath     = "/token"
+	oidcUserInfoPath  = "/userinfo"
+
+	defaultOIDCTokenTTL = time.Hour
+	defaultOIDCSubject  = "user"
+
+	oidcGrantClientCredentials = "client_credentials"
+	oidcGrantPassword          = "password"
+)
+
+const (
+	oidcEndpointUnknown = iota
+	oidcEndpointDiscovery
+	oidcEndpointJWKS
+	oidcEndpointToken
+	oidcEndpointUserInfo
+)
+
+type oidcEndpoint uint8
+
+// oidcRegisteredClaims are left out of the user info response.
+var oidcRegisteredClaims = []string{"iss", "aud", "exp", "iat", "nbf", "scope", "client_id"}
+
+type oidcRuntime struct {
+	issuer       string
+	basePath     string
+	signer       *jwtSigner
+	verifier     *jwtMatcherRuntime
+	clientID     *string
+	clientSecret *string
+	audience     *string
+	ttl          time.Duration
+	claims       map[string]any
+}
+
+type oidcEndpointRuntime struct {
+	provider *oidcRuntime
+	endpoint oidcEndpoint
+}
+
+func validateOIDCProvider(o *OIDCProvider) (*oidcRuntime, error) {
+	if o == nil {
+		return nil, nil
+	}
+
+	if o.Issuer == nil {
+		return nil, fmt.Errorf("must specify an issuer in oidc")
+	}
+	u, err := url.Parse(*o.Issuer)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+		return nil, fmt.Errorf("invalid issuer %q in oidc, must be an http or https URL without a query or fragment", *o.Issuer)
+	}
+	r := &oidcRuntime{
+		issuer:       strings.TrimSuffix(*o.Issuer, "/"),
+		basePath:     strings.TrimSuffix(u.Path, "/"),
+		clientID:     o.ClientID,
+		clientSecret: o.ClientSecret,
+		audience:     o.Audience,
+		ttl:          defaultOIDCTokenTTL,
+		claims:       o.Claims,
+	}
+	if o.ClientSecret != nil && o.ClientID == nil {
+		return nil, fmt.Errorf("cannot specify client secret in oidc without a client ID")
+	}
+
+	var key crypto.Signer
+	if o.SigningKey != nil {
+		key, err = parsePrivateKeyPEM(*o.SigningKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid signing key in oidc, reason: %w", err)
+		}
+	} else {
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate the signing key in oidc, reason: %w", err)
+		}
+	}
+	kid := ""
+	if o.KeyID != nil {
+		kid = *o.KeyID
+	}
+	r.signer, err = newJWTSigner(key, kid)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing key in oidc, reason: %w", err)
+	}
+	r.verifier = &jwtMatcherRuntime{
+		keys:   []*jwtKey{r.signer.verificationKey()},
+		issuer: &r.issuer,
+	}
+
+	if o.TokenTTL != nil {
+		d, err := time.ParseDuration(*o.TokenTTL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid token ttl in oidc, reason: %w", err)
+		}
+		if d < time.Second {
+			return nil, fmt.Errorf("token ttl in oidc must be at least a second")
+		}
+		r.ttl = d
+	}
+
+	return r, nil
+}
+
+// matchers returns the matchers serving the endpoints of the provider.
+func (o *oidcRuntime) matchers() []*matcherRuntime {
+	endpoints := []struct {
+		path     string
+		methods  []string
+		endpoint oidcEndpoint
+	}{
+		{oidcDiscoveryPath, []string{http.MethodGet}, oidcEndpointDiscovery},
+		{oidcJWKSPath, []string{http.MethodGet}, oidcEndpointJWKS},
+		{oidcTokenPath, []string{http.MethodPost}, oidcEndpointToken},
+		{oidcUserInfoPath, []string{http.MethodGet, http.MethodPost}, oidcEndpointUserInfo},
+	}
+
+	var result []*matcherRuntime
+	for _, e := range endpoints {
+		path := o.basePath + e.path
+		result = append(result, &matcherRuntime{
+			path: &pathRuntime{
+				mode: pathMatcherModeAbsolutePath,
+				abs:  &path,
+			},
+			methods:    e.methods,
+			statusCode: http.StatusOK,
+			resp: &responseRuntime{
+				mode: responseModeOIDC,
+				oidc: &oidcEndpointRuntime{provider: o, endpoint: e.endpoint},
+			},
+		})
+	}
+	return result
+}
+
+func (e *oidcEndpointRuntime) respond(state *requestState, writer http.ResponseWriter) {
+	o := e.provider
+	switch e.endpoint {
+	case oidcEndpointDiscovery:
+		writeJSON(writer, http.StatusOK, o.discovery())
+	case oidcEndpointJWKS:
+		writeJSON(writer, http.StatusOK, map[string]any{
+			"keys": []any{o.signer.publicJWK()},
+		})
+	case oidcEndpointToken:
+		o.issueToken(state, writer)
+	case oidcEndpointUserInfo:
+		o.userInfo(state, writer)
+	}
+}
+
+func (o *oidcRuntime) discovery() map[string]any {
+	return map[string]any{
+		"issuer":                                o.issuer,
+		"jwks_uri":                              o.issuer + oidcJWKSPath,
+		"token_endpoint":                        o.issuer + oidcTokenPath,
+		"userinfo_endpoint":                     o.issuer + oidcUserInfoPath,
+		"grant_types_supported":                 []string{oidcGrantClientCredentials, oidcGrantPassword},
+		"response_types_supported":              []string{"token"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{o.signer.alg},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post"},
+	}
+}
+
+func writeOAuthError(writer http.ResponseWriter, statusCode int, code string) {
+	writeJSON(writer, statusCode, map[string]any{"error": code})
+}
+
+// issueToken responds to the token request with an access token, and an
+// ID token when the openid scope is requested. The credentials of the
+// users are not checked.
+func (o *oidcRuntime) issueToken(state *requestState, writer http.ResponseWriter) {
+	writer.Header().Set("Cache-Control", "no-store")
+
+	body, err := state.readBody()
+	if err != nil {
+		writeOAuthError(writer, http.StatusBadRequest, "invalid_request")
+		return
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		writeOAuthError(writer, http.StatusBadRequest, "invalid_request")
+		return
+	}
+
+	clientID, clientSecret, ok := state.req.BasicAuth()
+	if !ok {
+		clientID, clientSecret = form.Get("client_id"), form.Get("client_secret")
+	}
+	if !o.authenticateClient(clientID, clientSecret) {
+		writer.Header().Set("WWW-Authenticate", `Basic realm="oidc"`)
+		writeOAuthError(writer, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+
+	subject := clientID
+	switch form.Get("grant_type") {
+	case oidcGrantClientCredentials:
+	case oidcGrantPassword:
+		subject = form.Get("username")
+		if subject == "" {
+			writeOAuthError(writer, http.StatusBadRequest, "invalid_request")
+			return
+		}
+	default:
+		writeOAuthError(writer, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+	if subject == "" {
+		subject = defaultOIDCSubject
+	}
+
+	now := time.Now()
+	claims := map[string]any{
+		"iss": o.issuer,
+		"sub": subject,
+		"iat": now.Unix(),
+		"exp": now.Add(o.ttl).Unix(),
+	}
+	if aud := o.tokenAudience(clientID); aud != "" {
+		claims["aud"] = aud
+	}
+	if clientID != "" {
+		claims["client_id"] = clientID
+	}
+	scope := form.Get("scope")
+	if scope != "" {
+		claims["scope"] = scope
+	}
+	for k, v := range o.claims {
+		claims[k] = v
+	}
+
+	accessToken, err := o.signer.sign(claims)
+	if err != nil {
+		respondWithError(writer, fmt.Sprintf("failed while signing the token, reason: %s", err.Error()))
+		return
+	}
+	resp := map[string]any{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int64(o.ttl.Seconds()),
+	}
+	if scope != "" {
+		resp["scope"] = scope
+	}
+	for _, s := range strings.Fields(scope) {
+		if s == "openid" {
+			idToken, err := o.signer.sign(o.idTokenClaims(subject, clientID, now))
+			if err != nil {
+				respondWithError(writer, fmt.Sprintf("failed while signing the token, reason: %s", err.Error()))
+				return
+			}
+			resp["id_token"] = idToken
+			break
+		}
+	}
+	writeJSON(writer, http.StatusOK, resp)
+}
+
+// idTokenClaims returns the claims of the ID token, whose audience is
+// always the client regardless of the audience of the access token. The
+// audience falls back to the configured one, or the issuer, when there is
+// no client so that the ID token always carries the required aud claim.
+func (o *oidcRuntime) idTokenClaims(subject, clientID string, now time.Time) map[string]any {
+	claims := map[string]any{
+		"iss": o.issuer,
+		"sub": subject,
+		"iat": now.Unix(),
+		"exp": now.Add(o.ttl).Unix(),
+	}
+	for k, v := range o.claims {
+		claims[k] = v
+	}
+	aud := clientID
+	if aud == "" {
+		aud = o.tokenAudience("")
+	}
+	if aud == "" {
+		aud = o.issuer
+	}
+	claims["aud"] = aud
+	return claims
+}
+
+// authenticateClient returns true if the client credentials match the
+// configured client, or if no client is configured.
+func (o *oidcRuntime) authenticateClient(clientID, clientSecret string) bool {
+	if o.clientID == nil {
+		return true
+	}
+	if subtle.ConstantTimeCompare([]byte(clientID), []byte(*o.clientID)) != 1 {
+		return false
+	}
+	if o.clientSecret == nil {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(clientSecret), []byte(*o.clientSecret)) == 1
+}
+
+func (o *oidcRuntime) tokenAudience(clientID string) string {
+	if o.audience != nil {
+		return *o.audience
+	}
+	return clientID
+}
+
+// userInfo responds with the claims of the access token issued by the
+// provider, leaving out the registered claims.
+func (o *oidcRuntime) userInfo(state *requestState, writer http.ResponseWriter) {
+	claims, ok := o.verifier.verify(bearerToken(state))
+	if !ok || !o.verifier.validClaims(claims, time.Now()) {
+		writer.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		writeOAuthError(writer, http.StatusUnauthorized, "invalid_token")
+		return
+	}
+	for _, c := range oidcRegisteredClaims {
+		delete(claims, c)
+	}
+	writeJSON(writer, http.StatusOK, claims)
+}
@@ -0,0 +1,140 @@
+package traefik_inline_response
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// JSONPredicate is a condition on the value found at the JSON pointer
+// (RFC 6901) within a JSON document. The value must be equal to the
+// specified value, or match the regex, or both if both are specified. The
+// regex is matched against strings as is, and against other values
+// encoded as JSON.
+type JSONPredicate struct {
+	Pointer string  `json:"pointer" mapstructure:"pointer"`
+	Equals  any     `json:"equals" mapstructure:"equals"`
+	Regex   *string `json:"regex" mapstructure:"regex"`
+}
+
+type jsonPredicateRuntime struct {
+	pointer []string
+	equals  any
+	hasEq   bool
+	regex   *regexp.Regexp
+}
+
+func validateJSONPredicates(predicates []JSONPredicate, loc string) ([]*jsonPredicateRuntime, error) {
+	var result []*jsonPredicateRuntime
+	for _, p := range predicates {
+		ptr, err := parseJSONPointer(p.Pointer)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pointer in %s, reason: %w", loc, err)
+		}
+		pr := &jsonPredicateRuntime{pointer: ptr}
+
+		if p.Equals == nil && p.Regex == nil {
+			return nil, fmt.Errorf("at least one of equals or regex must be specified in %s", loc)
+		}
+		if p.Equals != nil {
+			// Normalize the value to the types produced while decoding JSON.
+			b, err := json.Marshal(p.Equals)
+			if err != nil {
+				return nil, fmt.Errorf("invalid equals value in %s, reason: %w", loc, err)
+			}
+			err = json.Unmarshal(b, &pr.equals)
+			if err != nil {
+				return nil, fmt.Errorf("invalid equals value in %s, reason: %w", loc, err)
+			}
+			pr.hasEq = true
+		}
+		if p.Regex != nil {
+			re, err := regexp.Compile(*p.Regex)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regex in %s, reason: %w", loc, err)
+			}
+			pr.regex = re
+		}
+		result = append(result, pr)
+	}
+	return result, nil
+}
+
+// matchJSONPredicates returns true if all the predicates are satisfied by
+// the decoded JSON document.
+func matchJSONPredicates(predicates []*jsonPredicateRuntime, doc any) bool {
+	for _, p := range predicates {
+		if !p.match(doc) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *jsonPredicateRuntime) match(doc any) bool {
+	v, ok := resolveJSONPointer(doc, p.pointer)
+	if !ok {
+		return false
+	}
+	if p.hasEq && !reflect.DeepEqual(v, p.equals) {
+		return false
+	}
+	if p.regex != nil && !p.regex.MatchString(jsonValueString(v)) {
+		return false
+	}
+	return true
+}
+
+func jsonValueString(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// parseJSONPointer splits the RFC 6901 JSON pointer into its unescaped
+// reference tokens.
+func parseJSONPointer(ptr string) ([]string, error) {
+	if ptr == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(ptr, "/") {
+		return nil, fmt.Errorf("json pointer %q must begin with a /", ptr)
+	}
+
+	tokens := strings.Split(ptr[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func resolveJSONPointer(doc any, tokens []string) (any, bool) {
+	cur := doc
+	for _, t := range tokens {
+		switch v := cur.(type) {
+		case map[string]any:
+			next, ok := v[t]
+			if !ok {
+				return nil, false
+			}
+			cur = next
+		case []any:
+			i, err := strconv.Atoi(t)
+			if err != nil || i < 0 || i >= len(v) || (len(t) > 1 && t[0] == '0') {
+				return nil, false
+			}
+			cur = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return cur, true
+}
@@ -0,0 +1,48 @@
+package traefik_inline_response
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// randomSource is a concurrency safe source of pseudo random numbers,
+// which can optionally be seeded to produce deterministic sequences.
+type randomSource struct {
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+func newRandomSource(seed *int64) *randomSource {
+	s := time.Now().UnixNano()
+	if seed != nil {
+		s = *seed
+	}
+	return &randomSource{
+		rng: rand.New(rand.NewSource(s)), //nolint:gosec
+	}
+}
+
+func (r *randomSource) intn(n int) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rng.Intn(n)
+}
+
+func (r *randomSource) int63n(n int64) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rng.Int63n(n)
+}
+
+func (r *randomSource) normFloat64() float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rng.NormFloat64()
+}
+
+func (r *randomSource) float64() float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rng.Float64()
+}
@@ -0,0 +1,196 @@
+package traefik_inline_response
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimit is the configuration for limiting the rate of requests using a
+// token bucket, optionally tracked separately for every key derived from
+// the request.
+type RateLimit struct {
+	Limit      *int        `json:"limit" mapstructure:"limit"`
+	Period     *string     `json:"period" mapstructure:"period"`
+	Burst      *int        `json:"burst" mapstructure:"burst"`
+	Key        *RequestKey `json:"key" mapstructure:"key"`
+	StatusCode *int        `json:"statusCode" mapstructure:"statusCode"`
+	Resp       Response    `json:"response" mapstructure:"response"`
+}
+
+const defaultRateLimitPeriod = time.Second
+
+// maxRateLimitKeys bounds the number of per key buckets tracked for a rate
+// limit. Once the limit is hit, the buckets which have refilled completely
+// are forgotten, and all of them if that is not enough.
+const maxRateLimitKeys = 10000
+
+type rateLimitRuntime struct {
+	// Tokens added to the bucket per second.
+	rate       float64
+	burst      int
+	key        *requestKeyRuntime
+	statusCode int
+	resp       *responseRuntime
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimitResult is the state of the bucket after taking a token for the
+// request.
+type rateLimitResult struct {
+	allowed   bool
+	remaining int
+	// Time until the bucket is full again.
+	reset time.Duration
+	// Time until the next token is available, when the request is not
+	// allowed.
+	retryAfter time.Duration
+}
+
+func validateRateLimit(rl *RateLimit, loc string) (*rateLimitRuntime, error) {
+	if rl == nil {
+		return nil, nil
+	}
+
+	if rl.Limit == nil || *rl.Limit <= 0 {
+		return nil, fmt.Errorf("must specify a positive limit in %s", loc)
+	}
+	period := defaultRateLimitPeriod
+	if rl.Period != nil {
+		p, err := time.ParseDuration(*rl.Period)
+		if err != nil {
+			return nil, fmt.Errorf("invalid period in %s, reason: %w", loc, err)
+		}
+		if p <= 0 {
+			return nil, fmt.Errorf("period in %s must be positive", loc)
+		}
+		period = p
+	}
+	r := &rateLimitRuntime{
+		rate:       float64(*rl.Limit) / period.Seconds(),
+		burst:      *rl.Limit,
+		statusCode: http.StatusTooManyRequests,
+		buckets:    make(map[string]*tokenBucket),
+	}
+	if rl.Burst != nil {
+		if *rl.Burst <= 0 {
+			return nil, fmt.Errorf("burst in %s must be positive", loc)
+		}
+		r.burst = *rl.Burst
+	}
+
+	k, err := validateRequestKey(rl.Key, loc)
+	if err != nil {
+		return nil, err
+	}
+	r.key = k
+
+	if rl.StatusCode != nil {
+		r.statusCode = *rl.StatusCode
+	}
+	resp, err := validateResponse(&rl.Resp, loc, false)
+	if err != nil {
+		return nil, err
+	}
+	r.resp = resp
+
+	return r, nil
+}
+
+// take takes a token from the bucket tracked for the request.
+func (r *rateLimitRuntime) take(state *requestState, now time.Time) *rateLimitResult {
+	key := ""
+	if r.key != nil {
+		key = r.key.value(state)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, ok := r.buckets[key]
+	if !ok {
+		if len(r.buckets) >= maxRateLimitKeys {
+			r.prune(now)
+		}
+		if len(r.buckets) >= maxRateLimitKeys {
+			// Reject the new keys rather than forgetting the limited ones,
+			// so that the limits cannot be reset by flooding unique keys.
+			return &rateLimitResult{
+				retryAfter: r.duration(1),
+				reset:      r.duration(float64(r.burst)),
+			}
+		}
+		b = &tokenBucket{tokens: float64(r.burst), last: now}
+		r.buckets[key] = b
+	}
+	b.refill(now, r.rate, r.burst)
+
+	res := &rateLimitResult{}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.allowed = true
+	} else {
+		res.retryAfter = r.duration(1 - b.tokens)
+	}
+	res.remaining = int(b.tokens)
+	res.reset = r.duration(float64(r.burst) - b.tokens)
+	return res
+}
+
+// prune forgets the buckets which have refilled completely, since they
+// are indistinguishable from new buckets.
+func (r *rateLimitRuntime) prune(now time.Time) {
+	for k, b := range r.buckets {
+		b.refill(now, r.rate, r.burst)
+		if b.tokens >= float64(r.burst) {
+			delete(r.buckets, k)
+		}
+	}
+}
+
+// duration returns the time it takes to add the tokens to a bucket.
+func (r *rateLimitRuntime) duration(tokens float64) time.Duration {
+	return time.Duration(tokens / r.rate * float64(time.Second))
+}
+
+func (b *tokenBucket) refill(now time.Time, rate float64, burst int) {
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(float64(burst), b.tokens+elapsed*rate)
+		b.last = now
+	}
+}
+
+// setHeaders sets the RateLimit headers describing the state of the
+// bucket, and the Retry-After header when the request is not allowed.
+func (r *rateLimitRuntime) setHeaders(header http.Header, res *rateLimitResult) {
+	header.Set("RateLimit-Limit", strconv.Itoa(r.burst))
+	header.Set("RateLimit-Remaining", strconv.Itoa(res.remaining))
+	header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.reset)))
+	if !res.allowed {
+		header.Set("Retry-After", strconv.Itoa(ceilSeconds(res.retryAfter)))
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// allow takes a token for the request and sets the rate limit headers. It
+// returns false if the request is not allowed, in which case the rate
+// limit response must be sent.
+func (r *rateLimitRuntime) allow(state *requestState, writer http.ResponseWriter) bool {
+	res := r.take(state, time.Now())
+	r.setHeaders(writer.Header(), res)
+	return res.allowed
+}
@@ -0,0 +1,150 @@
+package traefik_inline_response
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// requestState holds the per request information derived while handling
+// the request, which is made available to the templates.
+type requestState struct {
+	req         *http.Request
+	store       *kvStore
+	maxBodySize int
+	pathParams  map[string]string
+	username    string
+	jwtClaims   map[string]any
+
+	clientIPResolver *clientIPRuntime
+	clientIPResolved bool
+	resolvedClientIP string
+
+	bodyRead bool
+	body     []byte
+	bodyErr  error
+
+	graphQLParsed bool
+	graphQLOp     *graphQLOperation
+
+	jsonRPCParsed bool
+	jsonRPCCall   *jsonRPCCall
+
+	soapParsed bool
+	soapReq    *soapRequest
+}
+
+// replayBody replays the part of the request body already read by the
+// plugin followed by the rest of the original body.
+type replayBody struct {
+	io.Reader
+	io.Closer
+}
+
+func newRequestState(req *http.Request, rt *handlerRuntime) *requestState {
+	return &requestState{
+		req:         req,
+		store:       rt.store,
+		maxBodySize: rt.maxBodySize,
+
+		clientIPResolver: rt.clientIP,
+	}
+}
+
+// clientIP resolves the client IP of the request once and returns the
+// same result on every subsequent invocation.
+func (s *requestState) clientIP() string {
+	if !s.clientIPResolved {
+		s.clientIPResolved = true
+		s.resolvedClientIP = s.clientIPResolver.resolve(s.req)
+	}
+	return s.resolvedClientIP
+}
+
+// readBody reads the request body once and returns the same result on
+// every subsequent invocation. The request body is restored so that it
+// can be read again in full by the next handler.
+func (s *requestState) readBody() ([]byte, error) {
+	if s.bodyRead {
+		return s.body, s.bodyErr
+	}
+	s.bodyRead = true
+
+	if s.req.Body == nil || s.req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	original := s.req.Body
+	b, err := io.ReadAll(io.LimitReader(original, int64(s.maxBodySize)+1))
+	s.req.Body = &replayBody{
+		Reader: io.MultiReader(bytes.NewReader(b), original),
+		Closer: original,
+	}
+	if err != nil {
+		s.bodyErr = fmt.Errorf("failed to read the request body, reason: %w", err)
+		return nil, s.bodyErr
+	}
+	if len(b) > s.maxBodySize {
+		s.bodyErr = fmt.Errorf("request body exceeds the maximum size of %d bytes", s.maxBodySize)
+		return nil, s.bodyErr
+	}
+	s.body = b
+	return s.body, nil
+}
+
+func (s *requestState) bodyJSON() (any, error) {
+	b, err := s.readBody()
+	if err != nil {
+		return nil, err
+	}
+	var result any
+	err = json.Unmarshal(b, &result)
+	if err != nil {
+		return nil, fmt.Errorf("request body is not valid JSON, reason: %w", err)
+	}
+	return result, nil
+}
+
+// graphQL parses the GraphQL operation in the request once and returns the
+// same result on every subsequent invocation.
+func (s *requestState) graphQL() *graphQLOperation {
+	if !s.graphQLParsed {
+		s.graphQLParsed = true
+		s.graphQLOp = parseGraphQLRequest(s)
+	}
+	return s.graphQLOp
+}
+
+// jsonRPC parses the JSON-RPC call in the request body once and returns the
+// same result on every subsequent invocation. Batches are not parsed here.
+func (s *requestState) jsonRPC() *jsonRPCCall {
+	if !s.jsonRPCParsed {
+		s.jsonRPCParsed = true
+		body, err := s.readBody()
+		if err == nil {
+			s.jsonRPCCall = parseJSONRPCCall(body)
+		}
+	}
+	return s.jsonRPCCall
+}
+
+// forJSONRPCCall returns a copy of the state for evaluating a single call
+// within a JSON-RPC batch.
+func (s *requestState) forJSONRPCCall(call *jsonRPCCall) *requestState {
+	c := *s
+	c.jsonRPCParsed = true
+	c.jsonRPCCall = call
+	return &c
+}
+
+// soap parses the SOAP request once and returns the same result on every
+// subsequent invocation.
+func (s *requestState) soap() *soapRequest {
+	if !s.soapParsed {
+		s.soapParsed = true
+		s.soapReq = parseSOAPRequest(s)
+	}
+	return s.soapReq
+}
@@ -1,6 +1,7 @@
 package traefik_inline_response_test
 
 import (
+	"io"
 	"net/http"
 	"net/http/httptest"
 )
@@ -53,11 +54,16 @@ func newNextHandler() *nextHandler {
 
 type nextHandler struct {
 	invoked bool
+	body    string
 }
 
 func (n *nextHandler) handlerFunc() http.HandlerFunc {
 	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
 		n.invoked = true
+		if req.Body != nil {
+			b, _ := io.ReadAll(req.Body)
+			n.body = string(b)
+		}
 	})
 }
 
@@ -0,0 +1,59 @@
+package traefik_inline_response
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+// sampleBuckets is the number of buckets the sticky sample keys are hashed
+// into, allowing sample rates with a precision of two decimal places.
+const sampleBuckets = 10000
+
+type sampleRuntime struct {
+	rate float64
+	key  *requestKeyRuntime
+}
+
+func validateSample(m *Matcher) (*sampleRuntime, error) {
+	if m.SampleRate == nil {
+		if m.SampleKey != nil {
+			return nil, fmt.Errorf("cannot specify sample key in the matcher without a sample rate")
+		}
+		return nil, nil
+	}
+
+	if *m.SampleRate < 0 || *m.SampleRate > 100 {
+		return nil, fmt.Errorf("sample rate in the matcher must be between 0 and 100")
+	}
+	k, err := validateRequestKey(m.SampleKey, "matcher sample")
+	if err != nil {
+		return nil, err
+	}
+	return &sampleRuntime{
+		rate: *m.SampleRate,
+		key:  k,
+	}, nil
+}
+
+// sampled returns true if the request is part of the sample. Requests with
+// the same key are consistently either part of the sample or not, while
+// the requests without a key are sampled at random.
+func (s *sampleRuntime) sampled(state *requestState, random *randomSource) bool {
+	if s.rate >= 100 {
+		return true
+	}
+
+	key := ""
+	if s.key != nil {
+		key = s.key.value(state)
+	}
+	if key == "" {
+		return random.float64()*100 < s.rate
+	}
+
+	h := fnv.New64a()
+	//nolint:errcheck
+	h.Write([]byte(key))
+	bucket := h.Sum64() % sampleBuckets
+	return float64(bucket) < s.rate*sampleBuckets/100
+}
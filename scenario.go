@@ -0,0 +1,109 @@
+package traefik_inline_response
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// scenarioStateStarted is the state every scenario begins in, and is
+// reset to.
+const scenarioStateStarted = "Started"
+
+type scenarioRuntime struct {
+	name          string
+	requiredState *string
+	newState      *string
+}
+
+// scenarioStore tracks the current state of every scenario.
+type scenarioStore struct {
+	mu     sync.Mutex
+	states map[string]string
+}
+
+func validateScenario(m *Matcher) (*scenarioRuntime, error) {
+	if m.Scenario == nil {
+		if m.RequiredState != nil {
+			return nil, fmt.Errorf("cannot specify required state in the matcher without a scenario")
+		}
+		if m.NewState != nil {
+			return nil, fmt.Errorf("cannot specify new state in the matcher without a scenario")
+		}
+		return nil, nil
+	}
+
+	if *m.Scenario == "" {
+		return nil, fmt.Errorf("scenario name in the matcher cannot be empty")
+	}
+
+	return &scenarioRuntime{
+		name:          *m.Scenario,
+		requiredState: m.RequiredState,
+		newState:      m.NewState,
+	}, nil
+}
+
+func newScenarioStore() *scenarioStore {
+	return &scenarioStore{
+		states: make(map[string]string),
+	}
+}
+
+// inState returns true if the scenario is in the required state (if any).
+func (s *scenarioStore) inState(sc *scenarioRuntime) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.inStateLocked(sc)
+}
+
+func (s *scenarioStore) inStateLocked(sc *scenarioRuntime) bool {
+	if sc.requiredState == nil {
+		return true
+	}
+	state, ok := s.states[sc.name]
+	if !ok {
+		state = scenarioStateStarted
+	}
+	return *sc.requiredState == state
+}
+
+// transition atomically verifies that the scenario is still in the required
+// state (if any) and moves it to the new state (if any). It returns false
+// if the scenario is not in the required state.
+func (s *scenarioStore) transition(sc *scenarioRuntime) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.inStateLocked(sc) {
+		return false
+	}
+	if sc.newState != nil {
+		s.states[sc.name] = *sc.newState
+	}
+	return true
+}
+
+// reset moves the specified scenario back to the started state, or all the
+// scenarios if the name is empty.
+func (s *scenarioStore) reset(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if name == "" {
+		s.states = make(map[string]string)
+		return
+	}
+	delete(s.states, name)
+}
+
+func (h *Handler) serveScenarioReset(writer http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		writer.Header().Set("Allow", http.MethodPost)
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	h.scenarios.reset(req.URL.Query().Get("scenario"))
+	writer.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,207 @@
+package traefik_inline_response
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a recurring cron-like schedule during which the matcher is
+// active. The cron expression has the five standard fields for the minute,
+// hour, day of month, month and day of week.
+type Schedule struct {
+	Cron     *string `json:"cron" mapstructure:"cron"`
+	TimeZone *string `json:"timeZone" mapstructure:"timeZone"`
+}
+
+type scheduleRuntime struct {
+	from     *time.Time
+	until    *time.Time
+	cron     *cronRuntime
+	location *time.Location
+}
+
+// cronRuntime holds the set of allowed values for every field of the cron
+// expression, indexed by the value.
+type cronRuntime struct {
+	minutes     []bool
+	hours       []bool
+	daysOfMonth []bool
+	months      []bool
+	daysOfWeek  []bool
+	// Whether the day of month and the day of week fields were restricted,
+	// since a day matches either of them when both are restricted.
+	domRestricted bool
+	dowRestricted bool
+}
+
+type cronField struct {
+	name  string
+	min   int
+	max   int
+	names []string
+}
+
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"", "JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}},
+	// 7 is also Sunday.
+	{name: "day of week", min: 0, max: 7, names: []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}},
+}
+
+func validateSchedule(m *Matcher) (*scheduleRuntime, error) {
+	if m.ActiveFrom == nil && m.ActiveUntil == nil && m.Schedule == nil {
+		return nil, nil
+	}
+
+	s := &scheduleRuntime{location: time.UTC}
+	if m.ActiveFrom != nil {
+		t, err := time.Parse(time.RFC3339, *m.ActiveFrom)
+		if err != nil {
+			return nil, fmt.Errorf("invalid active from in matcher, reason: %w", err)
+		}
+		s.from = &t
+	}
+	if m.ActiveUntil != nil {
+		t, err := time.Parse(time.RFC3339, *m.ActiveUntil)
+		if err != nil {
+			return nil, fmt.Errorf("invalid active until in matcher, reason: %w", err)
+		}
+		if s.from != nil && !t.After(*s.from) {
+			return nil, fmt.Errorf("active until must be after active from in matcher")
+		}
+		s.until = &t
+	}
+
+	if m.Schedule != nil {
+		if m.Schedule.Cron == nil {
+			return nil, fmt.Errorf("must specify cron in matcher schedule")
+		}
+		c, err := parseCron(*m.Schedule.Cron)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron %q in matcher schedule, reason: %w", *m.Schedule.Cron, err)
+		}
+		s.cron = c
+		if m.Schedule.TimeZone != nil {
+			loc, err := time.LoadLocation(*m.Schedule.TimeZone)
+			if err != nil {
+				return nil, fmt.Errorf("invalid time zone %q in matcher schedule, reason: %w", *m.Schedule.TimeZone, err)
+			}
+			s.location = loc
+		}
+	}
+
+	return s, nil
+}
+
+func parseCron(expr string) (*cronRuntime, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("expected %d fields but found %d", len(cronFields), len(fields))
+	}
+
+	sets := make([][]bool, len(cronFields))
+	for i, f := range cronFields {
+		set, err := f.parse(fields[i])
+		if err != nil {
+			return nil, err
+		}
+		sets[i] = set
+	}
+	// Sunday can be either 0 or 7.
+	sets[4][0] = sets[4][0] || sets[4][7]
+
+	return &cronRuntime{
+		minutes:       sets[0],
+		hours:         sets[1],
+		daysOfMonth:   sets[2],
+		months:        sets[3],
+		daysOfWeek:    sets[4],
+		domRestricted: !strings.HasPrefix(fields[2], "*"),
+		dowRestricted: !strings.HasPrefix(fields[4], "*"),
+	}, nil
+}
+
+// parse parses a comma separated list of values, ranges and steps like
+// 1,5-10,*/15 or MON-FRI into the set of allowed values.
+func (f *cronField) parse(expr string) ([]bool, error) {
+	set := make([]bool, f.max+1)
+	for _, part := range strings.Split(expr, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			s, err := strconv.Atoi(part[i+1:])
+			if err != nil || s <= 0 {
+				return nil, fmt.Errorf("invalid step %q in %s field", part[i+1:], f.name)
+			}
+			rng, step = part[:i], s
+		}
+
+		lo, hi := f.min, f.max
+		if rng != "*" {
+			bounds := strings.SplitN(rng, "-", 2)
+			v, err := f.value(bounds[0])
+			if err != nil {
+				return nil, err
+			}
+			lo, hi = v, v
+			if len(bounds) == 2 {
+				v, err = f.value(bounds[1])
+				if err != nil {
+					return nil, err
+				}
+				if v < lo {
+					return nil, fmt.Errorf("invalid range %q in %s field", rng, f.name)
+				}
+				hi = v
+			} else if step > 1 {
+				// A step after a single value runs till the maximum.
+				hi = f.max
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			set[v] = true
+		}
+	}
+	return set, nil
+}
+
+func (f *cronField) value(s string) (int, error) {
+	for i, n := range f.names {
+		if n != "" && strings.EqualFold(n, s) {
+			return i, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid value %q in %s field", s, f.name)
+	}
+	return v, nil
+}
+
+// active returns true if the time is within the active window and matches
+// the cron schedule.
+func (s *scheduleRuntime) active(now time.Time) bool {
+	if s.from != nil && now.Before(*s.from) {
+		return false
+	}
+	if s.until != nil && !now.Before(*s.until) {
+		return false
+	}
+	return s.cron == nil || s.cron.match(now.In(s.location))
+}
+
+func (c *cronRuntime) match(t time.Time) bool {
+	if !c.minutes[t.Minute()] || !c.hours[t.Hour()] || !c.months[int(t.Month())] {
+		return false
+	}
+	dom := c.daysOfMonth[t.Day()]
+	dow := c.daysOfWeek[int(t.Weekday())]
+	if c.domRestricted && c.dowRestricted {
+		return dom || dow
+	}
+	return dom && dow
+}
@@ -0,0 +1,125 @@
+package traefik_inline_response
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// Sequence is the configuration for returning a different response on
+// every subsequent request matching the same matcher.
+type Sequence struct {
+	Responses []SequenceResponse `json:"responses" mapstructure:"responses"`
+	Mode      *string            `json:"mode" mapstructure:"mode"`
+	Key       *RequestKey        `json:"key" mapstructure:"key"`
+}
+
+type SequenceResponse struct {
+	StatusCode *int     `json:"statusCode" mapstructure:"statusCode"`
+	Resp       Response `json:"response" mapstructure:"response"`
+}
+
+const (
+	sequenceModeCycle = "cycle"
+	sequenceModeStick = "stick"
+)
+
+// maxSequenceKeys bounds the number of per key positions tracked for a
+// sequence, so that clients cannot exhaust the memory by sending requests
+// with unique keys. All the positions are forgotten once the limit is hit.
+const maxSequenceKeys = 10000
+
+type sequenceRuntime struct {
+	// Accessed atomically and hence kept as the first field to guarantee
+	// 64-bit alignment.
+	count     uint64
+	responses []*sequenceResponseRuntime
+	stick     bool
+	key       *requestKeyRuntime
+	mu        sync.Mutex
+	counts    map[string]uint64
+}
+
+type sequenceResponseRuntime struct {
+	statusCode int
+	resp       *responseRuntime
+}
+
+func validateSequence(seq *Sequence) (*sequenceRuntime, error) {
+	if len(seq.Responses) == 0 {
+		return nil, fmt.Errorf("must specify at least one response in the matcher sequence")
+	}
+
+	s := &sequenceRuntime{
+		counts: make(map[string]uint64),
+	}
+
+	if seq.Mode != nil {
+		switch *seq.Mode {
+		case sequenceModeCycle:
+		case sequenceModeStick:
+			s.stick = true
+		default:
+			return nil, fmt.Errorf("invalid mode %q in the matcher sequence, must be one of %q or %q", *seq.Mode, sequenceModeCycle, sequenceModeStick)
+		}
+	}
+
+	k, err := validateRequestKey(seq.Key, "matcher sequence")
+	if err != nil {
+		return nil, err
+	}
+	s.key = k
+
+	for _, sr := range seq.Responses {
+		if sr.StatusCode == nil {
+			return nil, fmt.Errorf("must specify a status code in the matcher sequence response")
+		}
+		r, err := validateResponse(&sr.Resp, "matcher sequence", true)
+		if err != nil {
+			return nil, err
+		}
+		s.responses = append(s.responses, &sequenceResponseRuntime{
+			statusCode: *sr.StatusCode,
+			resp:       r,
+		})
+	}
+
+	return s, nil
+}
+
+// next returns the status code and the response for the next position in
+// the sequence tracked for the request.
+func (s *sequenceRuntime) next(state *requestState) (int, *responseRuntime) {
+	var pos uint64
+	if s.key == nil {
+		pos = atomic.AddUint64(&s.count, 1) - 1
+	} else {
+		pos = s.nextForKey(s.key.value(state))
+	}
+
+	n := uint64(len(s.responses))
+	var r *sequenceResponseRuntime
+	if s.stick && pos >= n {
+		r = s.responses[n-1]
+	} else {
+		r = s.responses[pos%n]
+	}
+	return r.statusCode, r.resp
+}
+
+func (s *sequenceRuntime) nextForKey(key string) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pos, ok := s.counts[key]
+	if !ok && len(s.counts) >= maxSequenceKeys {
+		s.counts = make(map[string]uint64)
+	}
+	next := pos + 1
+	if s.stick && next > uint64(len(s.responses)) {
+		// No need to keep counting once the last response is reached.
+		next = uint64(len(s.responses))
+	}
+	s.counts[key] = next
+	return pos
+}
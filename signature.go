@@ -0,0 +1,174 @@
+package traefik_inline_response
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HMACSignature is the configuration for verifying the HMAC signature of
+// the request body, optionally prefixed by a timestamp for protecting
+// against replays. Requests with a missing or invalid signature are sent
+// the reject response.
+type HMACSignature struct {
+	Secret             *string  `json:"secret" mapstructure:"secret"`
+	Algorithm          *string  `json:"algorithm" mapstructure:"algorithm"`
+	Header             *string  `json:"header" mapstructure:"header"`
+	Prefix             *string  `json:"prefix" mapstructure:"prefix"`
+	Encoding           *string  `json:"encoding" mapstructure:"encoding"`
+	TimestampHeader    *string  `json:"timestampHeader" mapstructure:"timestampHeader"`
+	TimestampSeparator *string  `json:"timestampSeparator" mapstructure:"timestampSeparator"`
+	Tolerance          *string  `json:"tolerance" mapstructure:"tolerance"`
+	StatusCode         *int     `json:"statusCode" mapstructure:"statusCode"`
+	Resp               Response `json:"response" mapstructure:"response"`
+}
+
+const (
+	hmacEncodingHex    = "hex"
+	hmacEncodingBase64 = "base64"
+
+	defaultHMACTimestampSeparator = "."
+	defaultHMACTolerance          = 5 * time.Minute
+)
+
+var hmacAlgorithms = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+type hmacSignatureRuntime struct {
+	secret          []byte
+	newHash         func() hash.Hash
+	header          string
+	prefix          string
+	base64          bool
+	timestampHeader string
+	separator       string
+	tolerance       time.Duration
+	statusCode      int
+	resp            *responseRuntime
+}
+
+func validateHMACSignature(sig *HMACSignature) (*hmacSignatureRuntime, error) {
+	if sig == nil {
+		return nil, nil
+	}
+
+	if sig.Secret == nil || *sig.Secret == "" {
+		return nil, fmt.Errorf("must specify a secret in matcher hmac")
+	}
+	if sig.Header == nil || *sig.Header == "" {
+		return nil, fmt.Errorf("must specify a header in matcher hmac")
+	}
+	h := &hmacSignatureRuntime{
+		secret:     []byte(*sig.Secret),
+		newHash:    sha256.New,
+		header:     *sig.Header,
+		separator:  defaultHMACTimestampSeparator,
+		tolerance:  defaultHMACTolerance,
+		statusCode: http.StatusUnauthorized,
+	}
+	if sig.Algorithm != nil {
+		f, ok := hmacAlgorithms[strings.ToLower(*sig.Algorithm)]
+		if !ok {
+			return nil, fmt.Errorf("invalid algorithm %q in matcher hmac, must be one of sha1, sha256 or sha512", *sig.Algorithm)
+		}
+		h.newHash = f
+	}
+	if sig.Prefix != nil {
+		h.prefix = *sig.Prefix
+	}
+	if sig.Encoding != nil {
+		switch *sig.Encoding {
+		case hmacEncodingHex:
+		case hmacEncodingBase64:
+			h.base64 = true
+		default:
+			return nil, fmt.Errorf("invalid encoding %q in matcher hmac, must be one of %s or %s", *sig.Encoding, hmacEncodingHex, hmacEncodingBase64)
+		}
+	}
+
+	if sig.TimestampHeader != nil {
+		h.timestampHeader = *sig.TimestampHeader
+		if sig.TimestampSeparator != nil {
+			h.separator = *sig.TimestampSeparator
+		}
+		if sig.Tolerance != nil {
+			d, err := time.ParseDuration(*sig.Tolerance)
+			if err != nil {
+				return nil, fmt.Errorf("invalid tolerance in matcher hmac, reason: %w", err)
+			}
+			if d <= 0 {
+				return nil, fmt.Errorf("tolerance in matcher hmac must be positive")
+			}
+			h.tolerance = d
+		}
+	} else if sig.TimestampSeparator != nil || sig.Tolerance != nil {
+		return nil, fmt.Errorf("cannot specify timestamp separator or tolerance in matcher hmac without a timestamp header")
+	}
+
+	if sig.StatusCode != nil {
+		h.statusCode = *sig.StatusCode
+	}
+	resp, err := validateResponse(&sig.Resp, "matcher hmac", false)
+	if err != nil {
+		return nil, err
+	}
+	h.resp = resp
+
+	return h, nil
+}
+
+// verify returns true if the signature header carries the HMAC of the
+// request body, prefixed by the timestamp and the separator when a
+// timestamp header is configured. The timestamp must be within the
+// tolerance of the current time.
+func (h *hmacSignatureRuntime) verify(state *requestState, now time.Time) bool {
+	v := state.req.Header.Get(h.header)
+	if !strings.HasPrefix(v, h.prefix) {
+		return false
+	}
+	var sig []byte
+	var err error
+	if h.base64 {
+		sig, err = base64.StdEncoding.DecodeString(v[len(h.prefix):])
+	} else {
+		sig, err = hex.DecodeString(v[len(h.prefix):])
+	}
+	if err != nil || len(sig) == 0 {
+		return false
+	}
+
+	body, err := state.readBody()
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(h.newHash, h.secret)
+	if h.timestampHeader != "" {
+		ts := state.req.Header.Get(h.timestampHeader)
+		secs, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil {
+			return false
+		}
+		skew := now.Sub(time.Unix(secs, 0))
+		if skew > h.tolerance || skew < -h.tolerance {
+			return false
+		}
+		//nolint:errcheck
+		mac.Write([]byte(ts + h.separator))
+	}
+	//nolint:errcheck
+	mac.Write(body)
+	return hmac.Equal(sig, mac.Sum(nil))
+}
@@ -0,0 +1,256 @@
+package traefik_inline_response
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"text/template"
+)
+
+// SOAPMatcher is a set of conditions on the SOAP request, all of which
+// must be satisfied for the matcher to match the request.
+type SOAPMatcher struct {
+	Action      *string `json:"action" mapstructure:"action"`
+	BodyElement *string `json:"bodyElement" mapstructure:"bodyElement"`
+}
+
+// SOAP is the configuration for responding with a SOAP envelope wrapping
+// either the payload or a fault.
+type SOAP struct {
+	Version  *string    `json:"version" mapstructure:"version"`
+	Template *string    `json:"template" mapstructure:"template"`
+	Fault    *SOAPFault `json:"fault" mapstructure:"fault"`
+}
+
+// SOAPFault is the fault sent within the SOAP body. The detail is included
+// as is and hence must be valid XML.
+type SOAPFault struct {
+	Code   *string `json:"code" mapstructure:"code"`
+	Reason *string `json:"reason" mapstructure:"reason"`
+	Detail *string `json:"detail" mapstructure:"detail"`
+}
+
+const (
+	soapVersion11 = "1.1"
+	soapVersion12 = "1.2"
+)
+
+const (
+	soap11Namespace   = "http://schemas.xmlsoap.org/soap/envelope/"
+	soap12Namespace   = "http://www.w3.org/2003/05/soap-envelope"
+	soap11ContentType = "text/xml; charset=utf-8"
+	soap12ContentType = "application/soap+xml; charset=utf-8"
+)
+
+type soapMatcherRuntime struct {
+	action      *string
+	bodyElement *string
+}
+
+type soapRuntime struct {
+	version string
+	templ   *template.Template
+	fault   *soapFaultRuntime
+}
+
+type soapFaultRuntime struct {
+	code   string
+	reason string
+	detail *string
+}
+
+// soapRequest is the information parsed from a SOAP request.
+type soapRequest struct {
+	Action      string
+	BodyElement string
+}
+
+func validateSOAPMatcher(soap *SOAPMatcher) (*soapMatcherRuntime, error) {
+	if soap == nil {
+		return nil, nil
+	}
+
+	if soap.Action == nil && soap.BodyElement == nil {
+		return nil, fmt.Errorf("at least one of action or body element must be specified in matcher soap")
+	}
+	return &soapMatcherRuntime{
+		action:      soap.Action,
+		bodyElement: soap.BodyElement,
+	}, nil
+}
+
+func validateSOAP(soap *SOAP, loc string) (*soapRuntime, error) {
+	s := &soapRuntime{version: soapVersion11}
+	if soap.Version != nil {
+		switch *soap.Version {
+		case soapVersion11, soapVersion12:
+			s.version = *soap.Version
+		default:
+			return nil, fmt.Errorf("invalid version %q in %s response soap, must be one of %q or %q", *soap.Version, loc, soapVersion11, soapVersion12)
+		}
+	}
+
+	if soap.Template != nil {
+		if soap.Fault != nil {
+			return nil, fmt.Errorf("cannot specify fault in %s response soap when template is specified", loc)
+		}
+		t, err := parseTextTemplate(*soap.Template)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template in %s response soap, reason: %w", loc, err)
+		}
+		s.templ = t
+	}
+
+	if soap.Fault != nil {
+		if soap.Fault.Reason == nil {
+			return nil, fmt.Errorf("must specify a reason in %s response soap fault", loc)
+		}
+		f := &soapFaultRuntime{
+			reason: *soap.Fault.Reason,
+			detail: soap.Fault.Detail,
+		}
+		if soap.Fault.Code != nil {
+			f.code = *soap.Fault.Code
+		} else if s.version == soapVersion11 {
+			f.code = "Server"
+		} else {
+			f.code = "Receiver"
+		}
+		s.fault = f
+	}
+
+	return s, nil
+}
+
+func (m *soapMatcherRuntime) match(state *requestState) bool {
+	sr := state.soap()
+	if sr == nil {
+		return false
+	}
+	if m.action != nil && sr.Action != *m.action {
+		return false
+	}
+	if m.bodyElement != nil && sr.BodyElement != *m.bodyElement {
+		return false
+	}
+	return true
+}
+
+// parseSOAPRequest extracts the action from the SOAPAction header (SOAP
+// 1.1) or the action parameter of the content type (SOAP 1.2), and the
+// local name of the first element within the SOAP body. It returns nil if
+// the request body is not a SOAP envelope.
+func parseSOAPRequest(state *requestState) *soapRequest {
+	body, err := state.readBody()
+	if err != nil || len(body) == 0 {
+		return nil
+	}
+
+	sr := &soapRequest{
+		Action: strings.Trim(state.req.Header.Get("SOAPAction"), `"`),
+	}
+	if _, params, err := mime.ParseMediaType(state.req.Header.Get("Content-Type")); err == nil && params["action"] != "" {
+		sr.Action = params["action"]
+	}
+
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	depth := 0
+	inBody := false
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			switch {
+			case depth == 1 && !isSOAPElement(t.Name, "Envelope"):
+				return nil
+			case depth == 2 && isSOAPElement(t.Name, "Body"):
+				inBody = true
+			case depth == 3 && inBody:
+				sr.BodyElement = t.Name.Local
+				return sr
+			}
+		case xml.EndElement:
+			if depth == 2 && inBody {
+				// Empty body.
+				return sr
+			}
+			depth--
+		}
+	}
+}
+
+func isSOAPElement(name xml.Name, local string) bool {
+	return name.Local == local && (name.Space == soap11Namespace || name.Space == soap12Namespace)
+}
+
+// render returns the SOAP envelope and its content type.
+func (s *soapRuntime) render(state *requestState) ([]byte, string, error) {
+	ns, contentType := soap11Namespace, soap11ContentType
+	if s.version == soapVersion12 {
+		ns, contentType = soap12Namespace, soap12ContentType
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(`<?xml version="1.0" encoding="utf-8"?>`)
+	buf.WriteString(`<soap:Envelope xmlns:soap="` + ns + `"><soap:Body>`)
+	if s.templ != nil {
+		payload, err := executeTextTemplate(s.templ, state)
+		if err != nil {
+			return nil, "", err
+		}
+		buf.WriteString(payload)
+	}
+	if s.fault != nil {
+		s.fault.render(&buf, s.version)
+	}
+	buf.WriteString(`</soap:Body></soap:Envelope>`)
+
+	return buf.Bytes(), contentType, nil
+}
+
+func (f *soapFaultRuntime) render(buf *bytes.Buffer, version string) {
+	buf.WriteString("<soap:Fault>")
+	if version == soapVersion11 {
+		buf.WriteString("<faultcode>soap:")
+		xmlEscape(buf, f.code)
+		buf.WriteString("</faultcode><faultstring>")
+		xmlEscape(buf, f.reason)
+		buf.WriteString("</faultstring>")
+		if f.detail != nil {
+			buf.WriteString("<detail>" + *f.detail + "</detail>")
+		}
+	} else {
+		buf.WriteString("<soap:Code><soap:Value>soap:")
+		xmlEscape(buf, f.code)
+		buf.WriteString(`</soap:Value></soap:Code><soap:Reason><soap:Text xml:lang="en">`)
+		xmlEscape(buf, f.reason)
+		buf.WriteString("</soap:Text></soap:Reason>")
+		if f.detail != nil {
+			buf.WriteString("<soap:Detail>" + *f.detail + "</soap:Detail>")
+		}
+	}
+	buf.WriteString("</soap:Fault>")
+}
+
+func xmlEscape(buf *bytes.Buffer, s string) {
+	//nolint:errcheck
+	xml.EscapeText(buf, []byte(s))
+}
+
+func (s *soapRuntime) respond(state *requestState, writer http.ResponseWriter, statusCode int) error {
+	body, contentType, err := s.render(state)
+	if err != nil {
+		return err
+	}
+	writer.Header().Set("Content-Type", contentType)
+	writer.WriteHeader(statusCode)
+	_, err = writer.Write(body)
+	return err
+}
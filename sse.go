@@ -0,0 +1,152 @@
+package traefik_inline_response
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// SSE is the configuration for streaming a list of server-sent events.
+type SSE struct {
+	Events   []SSEEvent `json:"events" mapstructure:"events"`
+	Interval *string    `json:"interval" mapstructure:"interval"`
+	Loop     bool       `json:"loop" mapstructure:"loop"`
+}
+
+// SSEEvent is a single server-sent event. The data is a go template
+// evaluated with the request as the input every time the event is sent.
+type SSEEvent struct {
+	ID    *string `json:"id" mapstructure:"id"`
+	Event *string `json:"event" mapstructure:"event"`
+	Data  *string `json:"data" mapstructure:"data"`
+	Retry *int    `json:"retry" mapstructure:"retry"`
+}
+
+type sseRuntime struct {
+	events   []*sseEventRuntime
+	interval time.Duration
+	loop     bool
+}
+
+type sseEventRuntime struct {
+	id    *string
+	event *string
+	data  *template.Template
+	retry *int
+}
+
+func validateSSE(sse *SSE, loc string) (*sseRuntime, error) {
+	if len(sse.Events) == 0 {
+		return nil, fmt.Errorf("must specify at least one event in %s response sse", loc)
+	}
+
+	s := &sseRuntime{loop: sse.Loop}
+	if sse.Interval != nil {
+		d, err := time.ParseDuration(*sse.Interval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid interval in %s response sse, reason: %w", loc, err)
+		}
+		if d < 0 {
+			return nil, fmt.Errorf("interval in %s response sse cannot be negative", loc)
+		}
+		s.interval = d
+	}
+	if s.loop && s.interval == 0 {
+		return nil, fmt.Errorf("must specify a positive interval in %s response sse when loop is enabled", loc)
+	}
+
+	for _, e := range sse.Events {
+		if e.ID != nil && strings.ContainsAny(*e.ID, "\r\n") {
+			return nil, fmt.Errorf("id in %s response sse event cannot contain line breaks", loc)
+		}
+		if e.Event != nil && strings.ContainsAny(*e.Event, "\r\n") {
+			return nil, fmt.Errorf("event in %s response sse event cannot contain line breaks", loc)
+		}
+		if e.Retry != nil && *e.Retry < 0 {
+			return nil, fmt.Errorf("retry in %s response sse event cannot be negative", loc)
+		}
+
+		er := &sseEventRuntime{
+			id:    e.ID,
+			event: e.Event,
+			retry: e.Retry,
+		}
+		if e.Data != nil {
+			t, err := parseTextTemplate(*e.Data)
+			if err != nil {
+				return nil, fmt.Errorf("invalid data template in %s response sse event, reason: %w", loc, err)
+			}
+			er.data = t
+		}
+		s.events = append(s.events, er)
+	}
+
+	return s, nil
+}
+
+// stream writes the events to the client flushing after every event,
+// until all the events are sent (only once unless looping) or the client
+// goes away.
+func (s *sseRuntime) stream(state *requestState, writer http.ResponseWriter, statusCode int) error {
+	flusher, ok := writer.(http.Flusher)
+	if !ok {
+		return fmt.Errorf("response writer does not support flushing, required for sse")
+	}
+
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.WriteHeader(statusCode)
+	flusher.Flush()
+
+	ctx := state.req.Context()
+	for {
+		for i, e := range s.events {
+			if i > 0 && !sleep(ctx, s.interval) {
+				return nil
+			}
+			b, err := e.render(state)
+			if err != nil {
+				// The status code has already been sent, so the error can
+				// only be reported as a comment.
+				b = []byte(fmt.Sprintf(": failed while rendering the event, reason: %s\n\n", strings.ReplaceAll(err.Error(), "\n", " ")))
+			}
+			_, err = writer.Write(b)
+			if err != nil {
+				return nil
+			}
+			flusher.Flush()
+		}
+		if !s.loop || !sleep(ctx, s.interval) {
+			return nil
+		}
+	}
+}
+
+func (e *sseEventRuntime) render(state *requestState) ([]byte, error) {
+	var buf bytes.Buffer
+	if e.id != nil {
+		buf.WriteString("id: " + *e.id + "\n")
+	}
+	if e.event != nil {
+		buf.WriteString("event: " + *e.event + "\n")
+	}
+	if e.retry != nil {
+		buf.WriteString("retry: " + strconv.Itoa(*e.retry) + "\n")
+	}
+	if e.data != nil {
+		data, err := executeTextTemplate(e.data, state)
+		if err != nil {
+			return nil, err
+		}
+		data = strings.ReplaceAll(data, "\r\n", "\n")
+		for _, line := range strings.Split(data, "\n") {
+			buf.WriteString("data: " + line + "\n")
+		}
+	}
+	buf.WriteString("\n")
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,281 @@
+package traefik_inline_response
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// StoreConfig is the configuration for the in-memory key value store
+// shared by all the matchers of the middleware.
+type StoreConfig struct {
+	MaxEntries   *int    `json:"maxEntries" mapstructure:"maxEntries"`
+	MaxKeySize   *int    `json:"maxKeySize" mapstructure:"maxKeySize"`
+	MaxValueSize *int    `json:"maxValueSize" mapstructure:"maxValueSize"`
+	TTL          *string `json:"ttl" mapstructure:"ttl"`
+}
+
+// StoreActions are the updates made to the key value store when a matcher
+// responds to a request. Keys and values are go templates evaluated with
+// the request as the input.
+type StoreActions struct {
+	Set    []StoreSet `json:"set" mapstructure:"set"`
+	Delete []string   `json:"delete" mapstructure:"delete"`
+}
+
+type StoreSet struct {
+	Key   string `json:"key" mapstructure:"key"`
+	Value string `json:"value" mapstructure:"value"`
+}
+
+const (
+	defaultStoreMaxEntries   = 1000
+	defaultStoreMaxKeySize   = 1024
+	defaultStoreMaxValueSize = 64 * 1024
+	defaultStoreTTL          = time.Hour
+)
+
+type storeActionsRuntime struct {
+	set    []*storeSetRuntime
+	delete []*template.Template
+}
+
+type storeSetRuntime struct {
+	key   *template.Template
+	value *template.Template
+}
+
+// storeUpdate is an evaluated store action, ready to be applied.
+type storeUpdate struct {
+	key    string
+	value  string
+	delete bool
+}
+
+// kvStore is a concurrency safe in-memory key value store bounded by the
+// number of entries and the size of the keys and the values, with every
+// entry expiring after a fixed TTL since it was last set.
+type kvStore struct {
+	mu           sync.Mutex
+	entries      map[string]*kvEntry
+	maxEntries   int
+	maxKeySize   int
+	maxValueSize int
+	ttl          time.Duration
+}
+
+type kvEntry struct {
+	value   string
+	expires time.Time
+}
+
+// storeEntry is a key value pair returned by the list template function.
+type storeEntry struct {
+	Key   string
+	Value string
+}
+
+func validateStoreConfig(store *StoreConfig) (*kvStore, error) {
+	s := &kvStore{
+		entries:      make(map[string]*kvEntry),
+		maxEntries:   defaultStoreMaxEntries,
+		maxKeySize:   defaultStoreMaxKeySize,
+		maxValueSize: defaultStoreMaxValueSize,
+		ttl:          defaultStoreTTL,
+	}
+	if store == nil {
+		return s, nil
+	}
+
+	if store.MaxEntries != nil {
+		if *store.MaxEntries <= 0 {
+			return nil, fmt.Errorf("max entries in the store must be positive")
+		}
+		s.maxEntries = *store.MaxEntries
+	}
+	if store.MaxKeySize != nil {
+		if *store.MaxKeySize <= 0 {
+			return nil, fmt.Errorf("max key size in the store must be positive")
+		}
+		s.maxKeySize = *store.MaxKeySize
+	}
+	if store.MaxValueSize != nil {
+		if *store.MaxValueSize <= 0 {
+			return nil, fmt.Errorf("max value size in the store must be positive")
+		}
+		s.maxValueSize = *store.MaxValueSize
+	}
+	if store.TTL != nil {
+		ttl, err := time.ParseDuration(*store.TTL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ttl in the store, reason: %w", err)
+		}
+		if ttl <= 0 {
+			return nil, fmt.Errorf("ttl in the store must be positive")
+		}
+		s.ttl = ttl
+	}
+
+	return s, nil
+}
+
+func validateStoreActions(actions *StoreActions) (*storeActionsRuntime, error) {
+	if actions == nil {
+		return nil, nil
+	}
+
+	a := &storeActionsRuntime{}
+	for _, set := range actions.Set {
+		k, err := parseTextTemplate(set.Key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key template in the matcher store set action, reason: %w", err)
+		}
+		v, err := parseTextTemplate(set.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value template in the matcher store set action, reason: %w", err)
+		}
+		a.set = append(a.set, &storeSetRuntime{key: k, value: v})
+	}
+	for _, del := range actions.Delete {
+		k, err := parseTextTemplate(del)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key template in the matcher store delete action, reason: %w", err)
+		}
+		a.delete = append(a.delete, k)
+	}
+
+	return a, nil
+}
+
+// evaluate evaluates the key and value templates of the actions, and
+// verifies that the keys and the values fit in the store. The store is
+// left untouched until the updates are applied.
+func (a *storeActionsRuntime) evaluate(state *requestState) ([]storeUpdate, error) {
+	if a == nil {
+		return nil, nil
+	}
+
+	var updates []storeUpdate
+	for _, set := range a.set {
+		k, err := executeTextTemplate(set.key, state)
+		if err != nil {
+			return nil, fmt.Errorf("failed while updating the store, reason: %w", err)
+		}
+		v, err := executeTextTemplate(set.value, state)
+		if err != nil {
+			return nil, fmt.Errorf("failed while updating the store, reason: %w", err)
+		}
+		err = state.store.checkSize(k, v)
+		if err != nil {
+			return nil, fmt.Errorf("failed while updating the store, reason: %w", err)
+		}
+		updates = append(updates, storeUpdate{key: k, value: v})
+	}
+	for _, del := range a.delete {
+		k, err := executeTextTemplate(del, state)
+		if err != nil {
+			return nil, fmt.Errorf("failed while updating the store, reason: %w", err)
+		}
+		updates = append(updates, storeUpdate{key: k, delete: true})
+	}
+	return updates, nil
+}
+
+func (s *kvStore) get(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok {
+		return "", false
+	}
+	if time.Now().After(e.expires) {
+		delete(s.entries, key)
+		return "", false
+	}
+	return e.value, true
+}
+
+func (s *kvStore) checkSize(key string, value string) error {
+	if len(key) > s.maxKeySize {
+		return fmt.Errorf("store key exceeds the maximum size of %d bytes", s.maxKeySize)
+	}
+	if len(value) > s.maxValueSize {
+		return fmt.Errorf("store value exceeds the maximum size of %d bytes", s.maxValueSize)
+	}
+	return nil
+}
+
+// apply applies the evaluated updates to the store all at once.
+func (s *kvStore) apply(updates []storeUpdate) {
+	if len(updates) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for _, u := range updates {
+		if u.delete {
+			delete(s.entries, u.key)
+			continue
+		}
+		if _, ok := s.entries[u.key]; !ok && len(s.entries) >= s.maxEntries {
+			s.purgeExpiredLocked(now)
+			if len(s.entries) >= s.maxEntries {
+				s.evictOldestLocked()
+			}
+		}
+		s.entries[u.key] = &kvEntry{
+			value:   u.value,
+			expires: now.Add(s.ttl),
+		}
+	}
+}
+
+// list returns the unexpired entries whose keys begin with the specified
+// prefix, sorted by their keys.
+func (s *kvStore) list(prefix string) []storeEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.purgeExpiredLocked(now)
+
+	result := make([]storeEntry, 0)
+	for k, e := range s.entries {
+		if strings.HasPrefix(k, prefix) {
+			result = append(result, storeEntry{Key: k, Value: e.value})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Key < result[j].Key
+	})
+	return result
+}
+
+func (s *kvStore) purgeExpiredLocked(now time.Time) {
+	for k, e := range s.entries {
+		if now.After(e.expires) {
+			delete(s.entries, k)
+		}
+	}
+}
+
+// evictOldestLocked removes the entry which was set the longest time ago,
+// i.e. the one closest to expiring.
+func (s *kvStore) evictOldestLocked() {
+	oldest := ""
+	var expires time.Time
+	for k, e := range s.entries {
+		if expires.IsZero() || e.expires.Before(expires) {
+			oldest = k
+			expires = e.expires
+		}
+	}
+	delete(s.entries, oldest)
+}
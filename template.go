@@ -0,0 +1,88 @@
+package traefik_inline_response
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"text/template"
+)
+
+const templateName = "traefik-inline-response"
+
+// templateFuncs returns the functions available to the templates for
+// the specified request. The state is nil while parsing the templates
+// since the functions are only invoked during execution.
+func templateFuncs(state *requestState) map[string]any {
+	return map[string]any{
+		"pathParam": func(name string) string {
+			return state.pathParams[name]
+		},
+		"body": func() (string, error) {
+			b, err := state.readBody()
+			return string(b), err
+		},
+		"clientIP": func() string {
+			return state.clientIP()
+		},
+		"username": func() string {
+			return state.username
+		},
+		"jwt": func() map[string]any {
+			return state.jwtClaims
+		},
+		"bodyJSON": func() (any, error) {
+			return state.bodyJSON()
+		},
+		"graphql": func() *graphQLOperation {
+			return state.graphQL()
+		},
+		"jsonrpc": func() *jsonRPCCall {
+			return state.jsonRPC()
+		},
+		"get": func(key string) string {
+			v, _ := state.store.get(key)
+			return v
+		},
+		"list": func(prefix string) []storeEntry {
+			return state.store.list(prefix)
+		},
+	}
+}
+
+func parseHTMLTemplate(text string) (*htmltemplate.Template, error) {
+	return htmltemplate.New(templateName).Funcs(templateFuncs(nil)).Parse(text)
+}
+
+func parseTextTemplate(text string) (*template.Template, error) {
+	return template.New(templateName).Funcs(templateFuncs(nil)).Parse(text)
+}
+
+// executeHTMLTemplate executes a clone of the parsed template bound to the
+// functions for the specified request. The parsed template itself is never
+// executed so that it can be cloned for every request.
+func executeHTMLTemplate(templ *htmltemplate.Template, state *requestState) ([]byte, error) {
+	t, err := templ.Clone()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	err = t.Funcs(templateFuncs(state)).Execute(&buf, state.req)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func executeTextTemplate(templ *template.Template, state *requestState) (string, error) {
+	t, err := templ.Clone()
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	err = t.Funcs(templateFuncs(state)).Execute(&buf, state.req)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
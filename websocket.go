@@ -0,0 +1,467 @@
+package traefik_inline_response
+
+import (
+	"bufio"
+	"crypto/sha1" //nolint:gosec
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WebSocket is the configuration for mocking a WebSocket endpoint.
+type WebSocket struct {
+	Mode     *string          `json:"mode" mapstructure:"mode"`
+	Messages []string         `json:"messages" mapstructure:"messages"`
+	Interval *string          `json:"interval" mapstructure:"interval"`
+	Close    bool             `json:"close" mapstructure:"close"`
+	Replies  []WebSocketReply `json:"replies" mapstructure:"replies"`
+	Default  *string          `json:"default" mapstructure:"default"`
+}
+
+// WebSocketReply is the message sent in response to a received text
+// message matching the regex. The message can refer to the capture groups
+// of the regex like $1 or ${name}.
+type WebSocketReply struct {
+	Match   *string `json:"match" mapstructure:"match"`
+	Message *string `json:"message" mapstructure:"message"`
+}
+
+const (
+	webSocketModeNameEcho   = "echo"
+	webSocketModeNameScript = "script"
+	webSocketModeNameReply  = "reply"
+)
+
+const (
+	webSocketModeUnknown = iota
+	webSocketModeEcho
+	webSocketModeScript
+	webSocketModeReply
+)
+
+type webSocketMode uint8
+
+// webSocketGUID is the magic value defined in RFC 6455 for computing the
+// Sec-WebSocket-Accept header.
+const webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// maxWebSocketMessageSize bounds the size of a message received from the
+// client, including all the fragments.
+const maxWebSocketMessageSize = 1 << 20
+
+// webSocketCloseTimeout bounds the time waited for the client to
+// acknowledge the close frame sent by the plugin.
+const webSocketCloseTimeout = 5 * time.Second
+
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xa
+)
+
+const (
+	wsCloseNormal        = 1000
+	wsCloseProtocolError = 1002
+	wsCloseTooBig        = 1009
+)
+
+var errWebSocketClosed = errors.New("websocket closed")
+
+type webSocketRuntime struct {
+	mode       webSocketMode
+	messages   []string
+	interval   time.Duration
+	closeAfter bool
+	replies    []*webSocketReplyRuntime
+	def        *string
+}
+
+type webSocketReplyRuntime struct {
+	match   *regexp.Regexp
+	message string
+}
+
+func validateWebSocket(ws *WebSocket, loc string) (*webSocketRuntime, error) {
+	w := &webSocketRuntime{def: ws.Default}
+
+	if ws.Mode == nil {
+		return nil, fmt.Errorf("must specify a mode in %s response websocket", loc)
+	}
+	switch *ws.Mode {
+	case webSocketModeNameEcho:
+		w.mode = webSocketModeEcho
+	case webSocketModeNameScript:
+		w.mode = webSocketModeScript
+	case webSocketModeNameReply:
+		w.mode = webSocketModeReply
+	default:
+		return nil, fmt.Errorf("invalid mode %q in %s response websocket, must be one of %q, %q or %q", *ws.Mode, loc, webSocketModeNameEcho, webSocketModeNameScript, webSocketModeNameReply)
+	}
+
+	if w.mode != webSocketModeScript && (len(ws.Messages) > 0 || ws.Interval != nil || ws.Close) {
+		return nil, fmt.Errorf("can only specify messages, interval and close in %s response websocket when mode is %q", loc, webSocketModeNameScript)
+	}
+	if w.mode != webSocketModeReply && (len(ws.Replies) > 0 || ws.Default != nil) {
+		return nil, fmt.Errorf("can only specify replies and default in %s response websocket when mode is %q", loc, webSocketModeNameReply)
+	}
+
+	if w.mode == webSocketModeScript {
+		if len(ws.Messages) == 0 {
+			return nil, fmt.Errorf("must specify at least one message in %s response websocket when mode is %q", loc, webSocketModeNameScript)
+		}
+		w.messages = ws.Messages
+		w.closeAfter = ws.Close
+		if ws.Interval != nil {
+			d, err := time.ParseDuration(*ws.Interval)
+			if err != nil {
+				return nil, fmt.Errorf("invalid interval in %s response websocket, reason: %w", loc, err)
+			}
+			if d < 0 {
+				return nil, fmt.Errorf("interval in %s response websocket cannot be negative", loc)
+			}
+			w.interval = d
+		}
+	}
+
+	if w.mode == webSocketModeReply {
+		if len(ws.Replies) == 0 && ws.Default == nil {
+			return nil, fmt.Errorf("must specify at least one reply or a default in %s response websocket when mode is %q", loc, webSocketModeNameReply)
+		}
+		for _, r := range ws.Replies {
+			if r.Match == nil || r.Message == nil {
+				return nil, fmt.Errorf("must specify both match and message in %s response websocket reply", loc)
+			}
+			re, err := regexp.Compile(*r.Match)
+			if err != nil {
+				return nil, fmt.Errorf("invalid match regex in %s response websocket reply, reason: %w", loc, err)
+			}
+			w.replies = append(w.replies, &webSocketReplyRuntime{
+				match:   re,
+				message: *r.Message,
+			})
+		}
+	}
+
+	return w, nil
+}
+
+// isWebSocketUpgrade verifies whether the request is a valid RFC 6455
+// opening handshake.
+func isWebSocketUpgrade(req *http.Request) bool {
+	return req.Method == http.MethodGet &&
+		headerContainsToken(req.Header, "Connection", "upgrade") &&
+		headerContainsToken(req.Header, "Upgrade", "websocket") &&
+		req.Header.Get("Sec-WebSocket-Version") == "13" &&
+		isValidWebSocketKey(req.Header.Get("Sec-WebSocket-Key"))
+}
+
+func headerContainsToken(header http.Header, name string, token string) bool {
+	for _, v := range header.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isValidWebSocketKey(key string) bool {
+	b, err := base64.StdEncoding.DecodeString(key)
+	return err == nil && len(b) == 16
+}
+
+func webSocketAccept(key string) string {
+	h := sha1.New() //nolint:gosec
+	h.Write([]byte(key + webSocketGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// respond completes the opening handshake and then exchanges messages with
+// the client until the connection is closed. Requests which are not valid
+// WebSocket handshakes only get the configured status code.
+func (w *webSocketRuntime) respond(writer http.ResponseWriter, req *http.Request, statusCode int) error {
+	if !isWebSocketUpgrade(req) {
+		writer.Header().Set("Sec-WebSocket-Version", "13")
+		writer.WriteHeader(statusCode)
+		return nil
+	}
+
+	conn, rw, err := hijack(writer)
+	if err != nil {
+		return err
+	}
+	//nolint:errcheck
+	defer conn.Close()
+
+	ws := &wsConn{conn: conn, r: rw.Reader, w: rw.Writer}
+	_, err = fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", webSocketAccept(req.Header.Get("Sec-WebSocket-Key")))
+	if err == nil {
+		err = rw.Flush()
+	}
+	if err != nil {
+		return nil
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	if w.mode == webSocketModeScript {
+		go w.runScript(ws, done)
+	}
+
+	for {
+		op, payload, err := ws.readMessage()
+		if err != nil {
+			return nil
+		}
+		switch w.mode {
+		case webSocketModeEcho:
+			err = ws.writeFrame(op, payload)
+		case webSocketModeReply:
+			if op != wsOpText {
+				continue
+			}
+			if reply, ok := w.reply(string(payload)); ok {
+				err = ws.writeFrame(wsOpText, []byte(reply))
+			}
+		}
+		if err != nil {
+			return nil
+		}
+	}
+}
+
+func (w *webSocketRuntime) runScript(ws *wsConn, done chan struct{}) {
+	for i, m := range w.messages {
+		if i > 0 && w.interval > 0 {
+			timer := time.NewTimer(w.interval)
+			select {
+			case <-timer.C:
+			case <-done:
+				timer.Stop()
+				return
+			}
+		}
+		if ws.writeFrame(wsOpText, []byte(m)) != nil {
+			return
+		}
+	}
+	if w.closeAfter {
+		ws.close(wsCloseNormal)
+	}
+}
+
+func (w *webSocketRuntime) reply(msg string) (string, bool) {
+	for _, r := range w.replies {
+		match := r.match.FindStringSubmatchIndex(msg)
+		if match != nil {
+			return string(r.match.ExpandString(nil, r.message, msg, match)), true
+		}
+	}
+	if w.def != nil {
+		return *w.def, true
+	}
+	return "", false
+}
+
+// wsConn is a minimal server side implementation of the RFC 6455 framing,
+// safe for a single reader and concurrent writers.
+type wsConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+
+	mu     sync.Mutex
+	w      *bufio.Writer
+	closed bool
+}
+
+// readMessage returns the next data message from the client after
+// reassembling the fragments, handling any control frames received in the
+// meantime.
+func (c *wsConn) readMessage() (byte, []byte, error) {
+	var msgOp byte
+	var msg []byte
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch op {
+		case wsOpPing:
+			err = c.writeFrame(wsOpPong, payload)
+			if err != nil {
+				return 0, nil, err
+			}
+			continue
+		case wsOpPong:
+			continue
+		case wsOpClose:
+			c.acknowledgeClose(payload)
+			return 0, nil, errWebSocketClosed
+		case wsOpText, wsOpBinary:
+			if msg != nil {
+				c.close(wsCloseProtocolError)
+				return 0, nil, errWebSocketClosed
+			}
+			msgOp = op
+			msg = payload
+		case wsOpContinuation:
+			if msg == nil {
+				c.close(wsCloseProtocolError)
+				return 0, nil, errWebSocketClosed
+			}
+			if len(msg)+len(payload) > maxWebSocketMessageSize {
+				c.close(wsCloseTooBig)
+				return 0, nil, errWebSocketClosed
+			}
+			msg = append(msg, payload...)
+		default:
+			c.close(wsCloseProtocolError)
+			return 0, nil, errWebSocketClosed
+		}
+
+		if fin {
+			return msgOp, msg, nil
+		}
+	}
+}
+
+func (c *wsConn) readFrame() (bool, byte, []byte, error) {
+	var header [2]byte
+	_, err := io.ReadFull(c.r, header[:])
+	if err != nil {
+		return false, 0, nil, err
+	}
+
+	fin := header[0]&0x80 != 0
+	op := header[0] & 0x0f
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7f)
+
+	if header[0]&0x70 != 0 || !masked {
+		// Extensions are never negotiated and clients must always mask
+		// their frames.
+		c.close(wsCloseProtocolError)
+		return false, 0, nil, errWebSocketClosed
+	}
+	if op >= wsOpClose && (!fin || length > 125) {
+		c.close(wsCloseProtocolError)
+		return false, 0, nil, errWebSocketClosed
+	}
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		_, err = io.ReadFull(c.r, ext[:])
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		_, err = io.ReadFull(c.r, ext[:])
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if err != nil {
+		return false, 0, nil, err
+	}
+	if length > maxWebSocketMessageSize {
+		c.close(wsCloseTooBig)
+		return false, 0, nil, errWebSocketClosed
+	}
+
+	var mask [4]byte
+	_, err = io.ReadFull(c.r, mask[:])
+	if err != nil {
+		return false, 0, nil, err
+	}
+	payload := make([]byte, length)
+	_, err = io.ReadFull(c.r, payload)
+	if err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return fin, op, payload, nil
+}
+
+func (c *wsConn) writeFrame(op byte, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return errWebSocketClosed
+	}
+	return c.writeFrameLocked(op, payload)
+}
+
+func (c *wsConn) writeFrameLocked(op byte, payload []byte) error {
+	header := []byte{0x80 | op}
+	n := len(payload)
+	switch {
+	case n <= 125:
+		header = append(header, byte(n))
+	case n <= 0xffff:
+		header = append(header, 126, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(n))
+	default:
+		header = append(header, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(n))
+	}
+
+	_, err := c.w.Write(header)
+	if err == nil {
+		_, err = c.w.Write(payload)
+	}
+	if err == nil {
+		err = c.w.Flush()
+	}
+	return err
+}
+
+// close initiates the closing handshake with the specified status code.
+// The connection is torn down once the client acknowledges, the read
+// deadline expires, or the handler returns.
+func (c *wsConn) close(code uint16) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return
+	}
+	var payload [2]byte
+	binary.BigEndian.PutUint16(payload[:], code)
+	//nolint:errcheck
+	c.writeFrameLocked(wsOpClose, payload[:])
+	c.closed = true
+	//nolint:errcheck
+	c.conn.SetReadDeadline(time.Now().Add(webSocketCloseTimeout))
+}
+
+// acknowledgeClose responds to a close frame received from the client,
+// unless the plugin initiated the closing handshake itself.
+func (c *wsConn) acknowledgeClose(payload []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return
+	}
+	if len(payload) > 2 {
+		payload = payload[:2]
+	}
+	//nolint:errcheck
+	c.writeFrameLocked(wsOpClose, payload)
+	c.closed = true
+}